@@ -0,0 +1,308 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// AuditIssueKind classifies a problem found by Audit.
+type AuditIssueKind string
+
+const (
+	// UnknownField is a stored field with no matching struct field.
+	UnknownField AuditIssueKind = "unknown_field"
+	// MissingRequired is a field tagged validate:"required" absent from the document.
+	MissingRequired AuditIssueKind = "missing_required"
+	// TypeMismatch is a stored value that cannot be decoded into its struct field.
+	TypeMismatch AuditIssueKind = "type_mismatch"
+	// DecodeFailed is a document DataTo cannot decode for another reason.
+	DecodeFailed AuditIssueKind = "decode_failed"
+	// ValidationFailed is a decoded document rejected by ValidateStruct.
+	ValidationFailed AuditIssueKind = "validation_failed"
+)
+
+// AuditIssue is a single problem found in a document.
+type AuditIssue struct {
+	DocumentID string         `json:"document_id"`
+	Kind       AuditIssueKind `json:"kind"`
+	Field      string         `json:"field,omitempty"`
+	Message    string         `json:"message"`
+}
+
+// AuditReport is the result of auditing a collection against its model.
+type AuditReport struct {
+	Model      string       `json:"model"`
+	Collection string       `json:"collection"`
+	Scanned    int          `json:"scanned"` // Documents read
+	Failed     int          `json:"failed"`  // Documents with at least one issue
+	Issues     []AuditIssue `json:"issues"`
+}
+
+// Counts returns the number of issues of each kind.
+func (r *AuditReport) Counts() map[AuditIssueKind]int {
+	counts := make(map[AuditIssueKind]int)
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+// AuditOption configures Audit.
+type AuditOption func(*auditOptions)
+
+type auditOptions struct {
+	includeDeleted bool
+	limit          int
+}
+
+// AuditIncludeDeleted also audits soft-deleted documents, which are skipped by default.
+func AuditIncludeDeleted() AuditOption {
+	return func(o *auditOptions) {
+		o.includeDeleted = true
+	}
+}
+
+// AuditLimit stops the audit after n documents.
+func AuditLimit(n int) AuditOption {
+	return func(o *auditOptions) {
+		o.limit = n
+	}
+}
+
+// Audit scans the collection of a registered model and compares every
+// document with the model's struct. It reports stored fields the struct
+// does not have, missing required fields, values of the wrong type and
+// documents failing ValidateStruct. model is the instance returned by
+// RegisterModel, or a handle derived from it with In or Group.
+func Audit(ctx context.Context, model interface{}, opts ...AuditOption) (*AuditReport, error) {
+	handle, ok := model.(interface{ baseModel() *BaseModel })
+	if !ok {
+		return nil, fmt.Errorf("cannot audit %T: expected a model registered with RegisterModel", model)
+	}
+	return handle.baseModel().audit(ctx, opts)
+}
+
+// baseModel returns the embedded BaseModel of a model handle.
+func (b *BaseModel) baseModel() *BaseModel {
+	return b
+}
+
+func (b *BaseModel) audit(ctx context.Context, opts []AuditOption) (report *AuditReport, err error) {
+	ctx, op := b.startOp(ctx, "Audit", "")
+	defer func() { op.end(err) }()
+
+	var options auditOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "Audit failed: %v", err)
+		return nil, err
+	}
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Audit failed: %v", err)
+		return nil, err
+	}
+	if !options.includeDeleted {
+		query = query.Where("deleted", "==", false)
+	}
+	query = query.OrderBy(firestore.DocumentID, firestore.Asc)
+
+	fields := schemaFields(info.Schema)
+	report = &AuditReport{Model: b.CollectionName + "." + b.ModelName, Collection: b.CollectionName, Issues: []AuditIssue{}}
+
+	var last *firestore.DocumentSnapshot
+	for {
+		pageSize := defaultPageSize
+		if options.limit > 0 && options.limit-report.Scanned < pageSize {
+			pageSize = options.limit - report.Scanned
+		}
+		if pageSize <= 0 {
+			break
+		}
+
+		page := query.Limit(pageSize)
+		if last != nil {
+			page = page.StartAfter(last)
+		}
+		iter := page.Documents(ctx)
+		read := 0
+		for {
+			doc, err := iter.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				b.logf(ctx, ERROR, "Audit of collection '%s' failed: %v", b.CollectionName, err)
+				return nil, err
+			}
+			read++
+			last = doc
+
+			issues := auditDocument(doc.Ref.ID, doc.Data(), doc.DataTo, info.Schema, fields)
+			if len(issues) > 0 {
+				report.Failed++
+				report.Issues = append(report.Issues, issues...)
+			}
+		}
+		iter.Stop()
+
+		report.Scanned += read
+		addReads(ctx, read)
+		if read < pageSize {
+			break
+		}
+	}
+
+	op.set("result_count", report.Scanned)
+	b.logf(ctx, INFO, "Audited %d documents in collection '%s': %d with issues", report.Scanned, b.CollectionName, report.Failed)
+	return report, nil
+}
+
+// auditDocument compares the data of a stored document with the model's
+// struct. decode is the document's DataTo.
+func auditDocument(id string, data map[string]interface{}, decode func(interface{}) error, schema reflect.Type, fields map[string]reflect.StructField) []AuditIssue {
+	var issues []AuditIssue
+	add := func(kind AuditIssueKind, field, format string, args ...interface{}) {
+		issues = append(issues, AuditIssue{DocumentID: id, Kind: kind, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mismatch := false
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			add(UnknownField, key, "field '%s' is not defined in the model", key)
+			continue
+		}
+		if !assignable(data[key], field.Type) {
+			mismatch = true
+			add(TypeMismatch, key, "field '%s' holds %T, expected %s", key, data[key], field.Type)
+		}
+	}
+
+	missing := false
+	for _, name := range sortedKeys(fields) {
+		if fields[name].Tag.Get("validate") != "required" {
+			continue
+		}
+		if _, ok := data[name]; !ok {
+			missing = true
+			add(MissingRequired, name, "required field '%s' is missing", name)
+		}
+	}
+
+	value := reflect.New(schema)
+	if err := decode(value.Interface()); err != nil {
+		if !mismatch {
+			add(DecodeFailed, "", "%v", err)
+		}
+		return issues
+	}
+	if !missing {
+		if err := ValidateStruct(value.Interface()); err != nil {
+			add(ValidationFailed, "", "%v", err)
+		}
+	}
+	return issues
+}
+
+// schemaFields maps the stored name of every persisted field of t to the
+// struct field, flattening embedded structs.
+func schemaFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := tagName(field.Tag.Get("firestore"))
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			for key, f := range schemaFields(field.Type) {
+				fields[key] = f
+			}
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// assignable reports whether a value read from Firestore can be decoded into
+// a field of type t, following the conversions DataTo accepts.
+func assignable(value interface{}, t reflect.Type) bool {
+	if value == nil {
+		return true // Null decodes to the zero value
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+
+	switch v := value.(type) {
+	case string:
+		return t.Kind() == reflect.String
+	case bool:
+		return t.Kind() == reflect.Bool
+	case int64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case float64:
+		switch t.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return v == float64(int64(v)) // DataTo only accepts integral values
+		}
+		return false
+	case []byte:
+		return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return false
+		}
+		for _, elem := range v {
+			if !assignable(elem, t.Elem()) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		return t.Kind() == reflect.Map || (t.Kind() == reflect.Struct && t != timeType)
+	}
+
+	// Timestamps, geo points and references decode into their own types.
+	vt := reflect.TypeOf(value)
+	if vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	return vt == t
+}
@@ -0,0 +1,131 @@
+package firegorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// GetMany fetches the documents with the given IDs in a single round trip and
+// appends them to results (a pointer to a slice) in the same order as ids.
+// IDs that do not exist, are soft deleted or belong to another tenant are
+// skipped and returned as missing.
+func (b *BaseModel) GetMany(ctx context.Context, ids []string, results interface{}, opts ...QueryOption) (missing []string, err error) {
+	ctx, op := b.startOp(ctx, "GetMany", "")
+	defer func() { op.end(err) }()
+
+	if err := b.EnsureCollection(); err != nil {
+		b.logf(ctx, ERROR, "GetMany failed: %v", err)
+		return nil, err
+	}
+
+	resultsVal := reflect.ValueOf(results)
+	if resultsVal.Kind() != reflect.Ptr || resultsVal.Elem().Kind() != reflect.Slice {
+		err := fmt.Errorf("results must be a pointer to a slice")
+		b.logf(ctx, ERROR, "GetMany failed: %v", err)
+		return nil, err
+	}
+	resultsVal = resultsVal.Elem()
+	itemType := resultsVal.Type().Elem()
+
+	col, err := b.collectionRef(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "GetMany failed: %v", err)
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = col.Doc(id)
+	}
+
+	docs, err := b.database().Client().GetAll(ctx, refs)
+	addReads(ctx, len(refs))
+	if err != nil {
+		b.logf(ctx, ERROR, "Failed to fetch documents from collection '%s': %v", col.Path, err)
+		return nil, err
+	}
+
+	tenancy := b.tenancy()
+	found, missing := partitionDocs(ids, docs, func(doc *firestore.DocumentSnapshot) bool {
+		return doc.Exists() && !isSoftDeleted(doc) && tenancy.owns(ctx, doc)
+	})
+
+	var loaded []reflect.Value
+	for _, doc := range found {
+		item, err := decodeDocument(doc, itemType)
+		if err != nil {
+			b.logf(ctx, ERROR, "GetMany failed: %v", err)
+			return nil, err
+		}
+		resultsVal.Set(reflect.Append(resultsVal, item))
+		loaded = append(loaded, structValue(resultsVal.Index(resultsVal.Len()-1)))
+	}
+
+	options := newQueryOptions(opts)
+	if err := b.preload(ctx, loaded, options.preload); err != nil {
+		return nil, err
+	}
+
+	op.set("result_count", len(loaded))
+	b.logf(ctx, INFO, "Fetched %d of %d documents from collection '%s', missing: %v", len(loaded), len(ids), col.Path, missing)
+	return missing, nil
+}
+
+// partitionDocs splits the snapshots fetched for ids, in the same order,
+// into the visible documents and the IDs of the others, keeping the order of ids.
+func partitionDocs(ids []string, docs []*firestore.DocumentSnapshot, visible func(*firestore.DocumentSnapshot) bool) (found []*firestore.DocumentSnapshot, missing []string) {
+	for i, doc := range docs {
+		if visible(doc) {
+			found = append(found, doc)
+		} else {
+			missing = append(missing, ids[i])
+		}
+	}
+	return found, missing
+}
+
+// Exists reports whether a document with the given ID exists and is not soft
+// deleted. Only the document name is downloaded, not its fields.
+func (b *BaseModel) Exists(ctx context.Context, id string) (exists bool, err error) {
+	ctx, op := b.startOp(ctx, "Exists", id)
+	defer func() { op.end(err) }()
+
+	if err := b.EnsureCollection(); err != nil {
+		b.logf(ctx, ERROR, "Exists failed: %v", err)
+		return false, err
+	}
+
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Exists failed: %v", err)
+		return false, err
+	}
+	if b.group {
+		query = query.Where("id", "==", id)
+	} else {
+		col, _ := b.collectionRef(ctx)
+		query = query.Where(firestore.DocumentID, "==", col.Doc(id))
+	}
+
+	iter := query.Where("deleted", "==", false).Select().Limit(1).Documents(ctx)
+	defer iter.Stop()
+
+	_, err = iter.Next()
+	addReads(ctx, 1)
+	if err == iterator.Done {
+		b.logf(ctx, DEBUG, "Document '%s' does not exist in collection '%s'", id, b.CollectionName)
+		return false, nil
+	}
+	if err != nil {
+		b.logf(ctx, ERROR, "Error checking existence of document '%s': %v", id, err)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,337 @@
+// Package cli implements the firegorm command-line tool. The stock binary in
+// cmd/firegorm works on raw collections, following firegorm's soft delete
+// conventions. Applications that want audit to know their models, writes to
+// run their validation and hooks, or migrate to run their migrations register
+// them and call Run from their own binary:
+//
+//	func main() {
+//		firegorm.RegisterModel(&Task{}, "tasks")
+//		opts := cli.Options{Migrations: appMigrations}
+//		if err := cli.Run(context.Background(), os.Args[1:], opts); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GEMSDEV-mx/firegorm"
+	"github.com/GEMSDEV-mx/firegorm/migrations"
+)
+
+// Options configures Run.
+type Options struct {
+	Stdout io.Writer // Defaults to os.Stdout
+	Stderr io.Writer // Defaults to os.Stderr
+	Stdin  io.Reader // Defaults to os.Stdin
+
+	// Migrations are run by the migrate command, with a Migrator built with
+	// MigratorOptions once connected.
+	Migrations      []migrations.Migration
+	MigratorOptions []migrations.Option
+}
+
+// command is a subcommand of the tool.
+type command struct {
+	usage   string
+	summary string
+	// connect is set for commands that need a Firestore client.
+	connect bool
+	run     func(ctx context.Context, env *env, args []string) error
+}
+
+// env is what commands run with.
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+	opts   Options
+}
+
+const (
+	modelsUsage  = "models"
+	auditUsage   = "audit [-in ids] [-group] [-limit n] [-include-deleted] [-json] <model>"
+	listUsage    = "list [-group] [-where expr] [-limit n] [-after id] [-sort fields] [-deleted] <collection> [field=value ...]"
+	getUsage     = "get [-deleted] <collection> <id>"
+	countUsage   = "count [-group] [-where expr] [-deleted] <collection> [field=value ...]"
+	exportUsage  = "export [-group] [-where expr] [-deleted] [-format jsonl|csv] [-o file] <collection> [field=value ...]"
+	importUsage  = "import [-in ids] [-format jsonl|csv] [-validate] [-batch n] <model> <file|->"
+	updateUsage  = "update <collection> <id> field=value ..."
+	deleteUsage  = "delete <collection> <id>"
+	restoreUsage = "restore <collection> <id>"
+	migrateUsage = "migrate up | down [n] | status"
+)
+
+var commands = map[string]command{
+	"models": {
+		usage:   modelsUsage,
+		summary: "list the registered models",
+		run:     runModels,
+	},
+	"audit": {
+		usage:   auditUsage,
+		summary: "report documents that do not match the model",
+		connect: true,
+		run:     runAudit,
+	},
+	"list": {
+		usage:   listUsage,
+		summary: "print matching documents as JSON lines",
+		connect: true,
+		run:     runList,
+	},
+	"get": {
+		usage:   getUsage,
+		summary: "print a document",
+		connect: true,
+		run:     runGet,
+	},
+	"count": {
+		usage:   countUsage,
+		summary: "count matching documents",
+		connect: true,
+		run:     runCount,
+	},
+	"export": {
+		usage:   exportUsage,
+		summary: "write every matching document as JSON lines",
+		connect: true,
+		run:     runExport,
+	},
+	"import": {
+		usage:   importUsage,
+		summary: "write the records of a file into a model's collection",
+		connect: true,
+		run:     runImport,
+	},
+	"update": {
+		usage:   updateUsage,
+		summary: "set fields of a document",
+		connect: true,
+		run:     runUpdate,
+	},
+	"delete": {
+		usage:   deleteUsage,
+		summary: "soft-delete a document",
+		connect: true,
+		run:     runDelete,
+	},
+	"restore": {
+		usage:   restoreUsage,
+		summary: "undo the soft delete of a document",
+		connect: true,
+		run:     runRestore,
+	},
+	"migrate": {
+		usage:   migrateUsage,
+		summary: "run or inspect migrations",
+		connect: true,
+		run:     runMigrate,
+	},
+}
+
+// Run parses the global connection flags and runs the command in args.
+func Run(ctx context.Context, args []string, opts Options) error {
+	e := &env{stdout: opts.Stdout, stderr: opts.Stderr, stdin: opts.Stdin, opts: opts}
+	if e.stdout == nil {
+		e.stdout = os.Stdout
+	}
+	if e.stderr == nil {
+		e.stderr = os.Stderr
+	}
+	if e.stdin == nil {
+		e.stdin = os.Stdin
+	}
+
+	fs := flag.NewFlagSet("firegorm", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	project := fs.String("project", "", "Google Cloud project ID")
+	database := fs.String("database", "", "Firestore database ID")
+	emulator := fs.String("emulator", "", "Firestore emulator host:port (FIRESTORE_EMULATOR_HOST is honoured as well)")
+	credentials := fs.String("credentials", "", "service account key file (Application Default Credentials if empty)")
+	tenant := fs.String("tenant", "", "tenant ID; limits the commands to its documents of tenant-scoped models")
+	fs.Usage = func() { usage(e.stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command given")
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command '%s'", name)
+	}
+
+	if cmd.connect && firegorm.Client == nil {
+		cfg := firegorm.Config{ProjectID: *project, DatabaseID: *database, EmulatorHost: *emulator}
+		if *credentials != "" {
+			data, err := os.ReadFile(*credentials)
+			if err != nil {
+				return fmt.Errorf("failed to read credentials: %w", err)
+			}
+			cfg.Credentials = string(data)
+		}
+		if err := firegorm.InitWithConfig(cfg); err != nil {
+			return err
+		}
+		defer firegorm.Close()
+	}
+	if *tenant != "" {
+		ctx = firegorm.WithTenant(ctx, *tenant)
+	}
+	return cmd.run(ctx, e, fs.Args()[1:])
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: firegorm [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", commands[name].usage, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
+
+// commandFlags returns the flag set of a command, printing usage on errors.
+func commandFlags(e *env, name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: firegorm %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// resolveModel finds a registered model by name ("tasks.Task") or by
+// collection, and binds it to its parents or to its collection group.
+func resolveModel(name, parents string, group bool) (*firegorm.BaseModel, error) {
+	model, err := firegorm.Model(name)
+	if err != nil {
+		var matches []string
+		for _, registered := range firegorm.ListModels() {
+			if info, err := firegorm.GetModelInfo(registered); err == nil && info.CollectionName == name {
+				matches = append(matches, registered)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("model '%s' is not registered; registered models: %s", name, strings.Join(firegorm.ListModels(), ", "))
+		case 1:
+			model, _ = firegorm.Model(matches[0])
+		default:
+			return nil, fmt.Errorf("collection '%s' has several models, use one of: %s", name, strings.Join(matches, ", "))
+		}
+	}
+
+	switch {
+	case group:
+		return model.Group(), nil
+	case parents != "":
+		return model.In(strings.Split(parents, ",")...), nil
+	}
+	return model, nil
+}
+
+func runModels(ctx context.Context, e *env, args []string) error {
+	fs := commandFlags(e, "models", modelsUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tCOLLECTION\tFIELDS")
+	for _, desc := range firegorm.Describe() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", desc.Name, desc.Collection, len(desc.Fields))
+	}
+	return tw.Flush()
+}
+
+func runAudit(ctx context.Context, e *env, args []string) error {
+	fs := commandFlags(e, "audit", auditUsage)
+	parents := fs.String("in", "", "comma-separated parent IDs of a subcollection")
+	group := fs.Bool("group", false, "audit the whole collection group")
+	limit := fs.Int("limit", 0, "stop after this many documents")
+	includeDeleted := fs.Bool("include-deleted", false, "also audit soft-deleted documents")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("audit takes exactly one model")
+	}
+
+	model, err := resolveModel(fs.Arg(0), *parents, *group)
+	if err != nil {
+		return err
+	}
+	opts := []firegorm.AuditOption{firegorm.AuditLimit(*limit)}
+	if *includeDeleted {
+		opts = append(opts, firegorm.AuditIncludeDeleted())
+	}
+	report, err := firegorm.Audit(ctx, model, opts...)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printAudit(e.stdout, report)
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d documents have issues", report.Failed, report.Scanned)
+	}
+	return nil
+}
+
+func printAudit(w io.Writer, report *firegorm.AuditReport) {
+	fmt.Fprintf(w, "Audited %d documents of %s: %d with issues\n", report.Scanned, report.Model, report.Failed)
+	if len(report.Issues) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOCUMENT\tKIND\tFIELD\tMESSAGE")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", issue.DocumentID, issue.Kind, issue.Field, issue.Message)
+	}
+	tw.Flush()
+}
+
+func runMigrate(ctx context.Context, e *env, args []string) error {
+	m := migrations.New(firegorm.Client, e.opts.MigratorOptions...)
+	if err := m.Register(e.opts.Migrations...); err != nil {
+		return err
+	}
+	if len(e.opts.Migrations) == 0 && len(args) > 0 && args[0] != "status" {
+		fmt.Fprintln(e.stderr, "No migrations are registered in this binary; pass them in cli.Options.Migrations.")
+	}
+	return m.RunCommand(ctx, args, e.stdout)
+}
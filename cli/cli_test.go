@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GEMSDEV-mx/firegorm"
+)
+
+type note struct {
+	firegorm.BaseModel
+	Text string `firestore:"text" json:"text"`
+}
+
+func run(args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := Run(context.Background(), args, Options{Stdout: &stdout, Stderr: &stderr})
+	return stdout.String(), stderr.String(), err
+}
+
+func TestRun_Usage(t *testing.T) {
+	if _, stderr, err := run(); err == nil || !strings.Contains(stderr, "Commands:") {
+		t.Errorf("expected usage and an error, got %v:\n%s", err, stderr)
+	}
+	if _, _, err := run("nope"); err == nil || !strings.Contains(err.Error(), "unknown command 'nope'") {
+		t.Errorf("expected unknown command error, got %v", err)
+	}
+	if _, _, err := run("-credentials", "/does/not/exist", "audit", "notes"); err == nil {
+		t.Error("expected error for a missing credentials file, got nil")
+	}
+}
+
+func TestRun_Models(t *testing.T) {
+	if _, err := firegorm.RegisterModel(&note{}, "notes"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	defer firegorm.Unregister("notes.note")
+
+	stdout, _, err := run("models")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout, "notes.note") {
+		t.Errorf("expected the registered model in the output, got:\n%s", stdout)
+	}
+
+	if _, err := resolveModel("notes", "", false); err != nil {
+		t.Errorf("expected model resolved by collection, got %v", err)
+	}
+	if _, err := resolveModel("missing", "", false); err == nil {
+		t.Error("expected error for an unregistered model, got nil")
+	}
+}
+
+func TestRun_DocumentArguments(t *testing.T) {
+	connect := []string{"-emulator", "localhost:1", "-project", "demo-cli"}
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"list"}, "list needs a collection"},
+		{[]string{"list", "-limit", "0", "tasks"}, "invalid limit"},
+		{[]string{"list", "tasks/t1"}, "is not a collection path"},
+		{[]string{"list", "-group", "orders/o1/items"}, "must be a collection ID"},
+		{[]string{"list", "tasks", "status"}, "expected field=value"},
+		{[]string{"get", "tasks"}, "get needs a collection and a document ID"},
+		{[]string{"update", "tasks", "t1"}, "update needs a collection and a document ID"},
+		{[]string{"update", "tasks", "t1", "id=2"}, "field 'id' cannot be updated"},
+		{[]string{"restore", "tasks/t1/notes"}, "restore needs a collection and a document ID"},
+		{[]string{"export", "-format", "xml", "tasks"}, "unsupported format 'xml'"},
+		{[]string{"export", "-format", "csv", "unregistered"}, "is not registered"},
+		{[]string{"import", "tasks"}, "import needs a model and a file"},
+		{[]string{"-tenant", "acme", "list", "tasks"}, "belongs to no tenant-scoped model"},
+		{[]string{"-tenant", "acme", "get", "tasks", "t1"}, "belongs to no tenant-scoped model"},
+		{[]string{"-tenant", "acme", "delete", "tasks", "t1"}, "belongs to no tenant-scoped model"},
+	}
+	for _, tt := range tests {
+		args := append(append([]string{}, connect...), tt.args...)
+		if tt.args[0] == "-tenant" {
+			// Global flags come before the command.
+			args = append(append([]string{}, tt.args[:2]...), append(connect, tt.args[2:]...)...)
+		}
+		_, _, err := run(args...)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.args, tt.expected, err)
+		}
+	}
+	if firegorm.Client != nil {
+		t.Error("expected the client opened by Run to be closed")
+	}
+}
+
+type item struct {
+	firegorm.BaseModel
+	TenantID string `firestore:"tenant_id" json:"tenant_id"`
+}
+
+func TestRegistered_Templates(t *testing.T) {
+	if _, err := firegorm.RegisterModel(&item{}, "orders/{orderID}/items"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	defer firegorm.Unregister("orders/{orderID}/items.item")
+
+	tests := []struct {
+		path      string
+		parentIDs []string
+		ok        bool
+	}{
+		{"orders/o1/items", []string{"o1"}, true},
+		{"orders/o1/notes", nil, false},
+		{"orders//items", nil, false},
+		{"items", nil, false},
+	}
+	for _, tt := range tests {
+		_, _, parentIDs, ok := registered(tt.path, false)
+		if ok != tt.ok || !reflect.DeepEqual(parentIDs, tt.parentIDs) {
+			t.Errorf("registered(%q): expected %v, %v, got %v, %v", tt.path, tt.parentIDs, tt.ok, parentIDs, ok)
+		}
+	}
+	if _, _, _, ok := registered("items", true); !ok {
+		t.Error("expected the collection group to match the last segment")
+	}
+	if pathModel("orders/o1/items") == nil || pathModel("orders/o1/notes") != nil {
+		t.Error("expected a write target only for the registered template")
+	}
+}
+
+func TestTenantScopeOf(t *testing.T) {
+	if _, err := firegorm.RegisterModel(&item{}, "items", firegorm.WithTenantField("tenant_id")); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	defer firegorm.Unregister("items.item")
+	if _, err := firegorm.RegisterModel(&note{}, "notes", firegorm.WithTenantPath("tenants")); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	defer firegorm.Unregister("notes.note")
+
+	ctx := firegorm.WithTenant(context.Background(), "acme")
+	if scope, err := tenantScopeOf(ctx, "items", false); err != nil || scope.field != "tenant_id" || scope.path != "items" {
+		t.Errorf("expected items filtered by tenant_id, got %+v, %v", scope, err)
+	}
+	if scope, err := tenantScopeOf(ctx, "notes", false); err != nil || scope.path != "tenants/acme/notes" {
+		t.Errorf("expected notes under the tenant document, got %+v, %v", scope, err)
+	}
+	if _, err := tenantScopeOf(ctx, "notes", true); err == nil {
+		t.Error("expected an error for a group query of a collection scoped by tenant path")
+	}
+	if scope, err := tenantScopeOf(context.Background(), "notes", false); err != nil || scope.path != "notes" {
+		t.Errorf("expected no scoping without -tenant, got %+v, %v", scope, err)
+	}
+}
+
+type contact struct {
+	firegorm.BaseModel
+	Phone string    `firestore:"phone" json:"phone"`
+	Calls int       `firestore:"calls" json:"calls"`
+	Tags  []string  `firestore:"tags" json:"tags"`
+	Due   time.Time `firestore:"due" json:"due"`
+}
+
+func TestModelValue(t *testing.T) {
+	if _, err := firegorm.RegisterModel(&contact{}, "contacts"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	defer firegorm.Unregister("contacts.contact")
+	_, info, _, ok := registered("contacts", false)
+	if !ok {
+		t.Fatal("expected the model to be registered")
+	}
+
+	tests := []struct {
+		key, raw string
+		expected interface{}
+	}{
+		{"phone", "5551234", "5551234"},
+		{"phone", `"quoted"`, "quoted"},
+		{"calls", "3", 3},
+		{"tags", `["a","b"]`, []string{"a", "b"}},
+		{"due", "2024-05-01T10:00:00Z", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"unknown", "3", int64(3)},
+	}
+	for _, tt := range tests {
+		got, err := modelValue(info, tt.key, tt.raw)
+		if err != nil || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("modelValue(%s=%s): expected %#v, got %#v, %v", tt.key, tt.raw, tt.expected, got, err)
+		}
+	}
+	if _, err := modelValue(info, "calls", "many"); err == nil {
+		t.Error("expected error for a non-numeric value of an int field, got nil")
+	}
+}
+
+func TestUpdateValue(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected interface{}
+	}{
+		{"open", "open"},
+		{"3", int64(3)},
+		{"1.5", 1.5},
+		{"true", true},
+		{"null", nil},
+		{`["a",2]`, []interface{}{"a", int64(2)}},
+		{"2024-05-01T10:00:00Z", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"3 apples", "3 apples"},
+	}
+	for _, tt := range tests {
+		if got := updateValue(tt.raw); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("updateValue(%q): expected %#v, got %#v", tt.raw, tt.expected, got)
+		}
+	}
+
+	got := toJSON(map[string]interface{}{"due": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), "tags": []interface{}{"a"}})
+	expected := map[string]interface{}{"due": "2024-05-01T10:00:00Z", "tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,694 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+
+	"github.com/GEMSDEV-mx/firegorm"
+)
+
+// The document commands work on collection paths such as "tasks" or
+// "orders/o1/items", or on a collection ID with -group. Like the library they
+// hide soft-deleted documents unless -deleted is given. With -tenant, they
+// only accept collections of tenant-scoped models and only see that tenant's
+// documents.
+
+// queryFlags are the flags shared by the commands reading several documents.
+type queryFlags struct {
+	group   *bool
+	deleted *bool
+	where   *string
+}
+
+func addQueryFlags(fs *flag.FlagSet) queryFlags {
+	return queryFlags{
+		group:   fs.Bool("group", false, "query every collection with this ID (collection group)"),
+		deleted: fs.Bool("deleted", false, "include soft-deleted documents"),
+		where:   fs.String("where", "", `filter expression, such as 'status in ("open","blocked") and due < 2025-05-01'`),
+	}
+}
+
+// query builds the query of a collection path filtered by field=value
+// arguments, in the notation of firegorm.ExtractFilters, and by -where.
+func (f queryFlags) query(ctx context.Context, path string, args []string) (firestore.Query, error) {
+	var query firestore.Query
+	if *f.group && strings.Contains(path, "/") {
+		return query, fmt.Errorf("collection group '%s' must be a collection ID, not a path", path)
+	}
+	scope, err := tenantScopeOf(ctx, path, *f.group)
+	if err != nil {
+		return query, err
+	}
+	if *f.group {
+		query = firegorm.Client.CollectionGroup(path).Query
+	} else {
+		col, err := collection(scope.path)
+		if err != nil {
+			return query, err
+		}
+		query = col.Query
+	}
+	query = scope.query(query)
+	if !*f.deleted {
+		query = query.Where("deleted", "==", false)
+	}
+
+	params, err := parseAssignments(args)
+	if err != nil {
+		return query, err
+	}
+	query, err = firegorm.ApplyFilters(query, firegorm.ExtractFilters(params, nil))
+	if err != nil || *f.where == "" {
+		return query, err
+	}
+	return firegorm.ApplyFilterExpr(query, *f.where)
+}
+
+// tenantScope is the tenant set with -tenant, applied to a collection read
+// by the raw commands.
+type tenantScope struct {
+	path     string // Collection path, under the tenant document for path scoping
+	field    string // Field holding the tenant ID, for field scoping
+	tenantID string
+}
+
+// tenantScopeOf resolves the tenant of ctx for the collection at path, or the
+// collection group with that ID. -tenant is refused for collections of models
+// that are not scoped by tenant, or of no model, as it could not scope them.
+func tenantScopeOf(ctx context.Context, path string, group bool) (tenantScope, error) {
+	scope := tenantScope{path: path}
+	tenantID, ok := firegorm.TenantFromContext(ctx)
+	if !ok {
+		return scope, nil
+	}
+	var tenancy *firegorm.Tenancy
+	if _, info, _, found := registered(path, group); found {
+		tenancy = info.Tenancy
+	}
+	switch {
+	case tenancy == nil:
+		return scope, fmt.Errorf("-tenant is given, but collection '%s' belongs to no tenant-scoped model", path)
+	case tenancy.Mode == firegorm.TenantField:
+		scope.field, scope.tenantID = tenancy.Field, tenantID
+	case group:
+		return scope, fmt.Errorf("collection group '%s' is scoped by tenant path and cannot be queried with -tenant", path)
+	case strings.Contains(tenantID, "/"):
+		return scope, fmt.Errorf("invalid tenant ID %q", tenantID)
+	default:
+		scope.path = tenancy.Root + "/" + tenantID + "/" + path
+	}
+	return scope, nil
+}
+
+// query restricts query to the documents of the tenant.
+func (s tenantScope) query(query firestore.Query) firestore.Query {
+	if s.field == "" {
+		return query
+	}
+	return query.Where(s.field, "==", s.tenantID)
+}
+
+// owns reports whether a fetched document belongs to the tenant.
+func (s tenantScope) owns(doc *firestore.DocumentSnapshot) bool {
+	if s.field == "" {
+		return true
+	}
+	stored, _ := doc.Data()[s.field].(string)
+	return stored == s.tenantID
+}
+
+// collection returns the collection at path.
+func collection(path string) (*firestore.CollectionRef, error) {
+	col := firegorm.Client.Collection(path)
+	if col == nil {
+		return nil, fmt.Errorf("'%s' is not a collection path", path)
+	}
+	return col, nil
+}
+
+// parseAssignments parses field=value arguments.
+func parseAssignments(args []string) (map[string]string, error) {
+	params := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid argument '%s', expected field=value", arg)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// modelValue converts the value of an update argument to the type of the
+// model field it sets: JSON values are decoded into it, and text that is not
+// valid JSON is taken as a JSON string, so phone=5551234 stays a string and
+// due=2025-05-01T10:00:00Z becomes a timestamp. Fields the model does not
+// declare fall back to updateValue, and Update reports the unknown ones.
+func modelValue(info firegorm.ModelInfo, key, raw string) (interface{}, error) {
+	name, ok := info.TagToFieldMap[key]
+	if !ok {
+		return updateValue(raw), nil
+	}
+	field, _ := info.Schema.FieldByName(name)
+	value := reflect.New(field.Type)
+	if err := json.Unmarshal([]byte(raw), value.Interface()); err != nil {
+		quoted, _ := json.Marshal(raw)
+		if json.Unmarshal(quoted, value.Interface()) != nil {
+			return nil, fmt.Errorf("invalid value for field '%s': expected %s", key, field.Type)
+		}
+	}
+	return value.Elem().Interface(), nil
+}
+
+// updateValue parses the value of an update argument of a collection no model
+// is registered for: JSON values such as
+// 3, true, null, ["a","b"] or {"k":1} are decoded, RFC 3339 timestamps become
+// timestamps and anything else is kept as a string.
+func updateValue(raw string) interface{} {
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t
+	}
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return raw
+	}
+	return fromJSON(v)
+}
+
+// fromJSON converts decoded JSON numbers to the integer or float values
+// Firestore stores.
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromJSON(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = fromJSON(v[k])
+		}
+	}
+	return v
+}
+
+// toJSON converts Firestore values to values encoding/json can print.
+func toJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case *firestore.DocumentRef:
+		if v == nil {
+			return nil
+		}
+		return v.Path
+	case *latlng.LatLng:
+		if v == nil {
+			return nil
+		}
+		return map[string]interface{}{"latitude": v.Latitude, "longitude": v.Longitude}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i := range v {
+			out[i] = toJSON(v[i])
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k := range v {
+			out[k] = toJSON(v[k])
+		}
+		return out
+	}
+	return v
+}
+
+// document returns the printable data of a snapshot. The "id" field is
+// filled from the document ID when missing.
+func document(doc *firestore.DocumentSnapshot) map[string]interface{} {
+	data := toJSON(doc.Data()).(map[string]interface{})
+	if _, ok := data["id"]; !ok {
+		data["id"] = doc.Ref.ID
+	}
+	return data
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	fs := commandFlags(e, "list", listUsage)
+	qf := addQueryFlags(fs)
+	limit := fs.Int("limit", 20, "maximum number of documents")
+	after := fs.String("after", "", "start after this document ID (a document path with -group)")
+	sortSpec := fs.String("sort", "", "sort fields, e.g. -created_at,title")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("list needs a collection")
+	}
+	if *limit < 1 {
+		return fmt.Errorf("invalid limit %d", *limit)
+	}
+
+	query, err := qf.query(ctx, fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	if *sortSpec != "" {
+		clauses, err := firegorm.ParseSort(*sortSpec)
+		if err != nil {
+			return err
+		}
+		for _, clause := range clauses {
+			query = query.OrderBy(clause.Field, clause.Direction)
+		}
+	}
+	if *after != "" {
+		var ref *firestore.DocumentRef
+		if *qf.group {
+			ref = firegorm.Client.Doc(*after)
+		} else {
+			scope, _ := tenantScopeOf(ctx, fs.Arg(0), false)
+			col, _ := collection(scope.path)
+			ref = col.Doc(*after)
+		}
+		if ref == nil {
+			return fmt.Errorf("'%s' is not a document path", *after)
+		}
+		snap, err := ref.Get(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read cursor document '%s': %w", *after, err)
+		}
+		query = query.StartAfter(snap)
+	}
+
+	docs, err := query.Limit(*limit).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(e.stdout)
+	for _, doc := range docs {
+		if err := enc.Encode(document(doc)); err != nil {
+			return err
+		}
+	}
+	if len(docs) == *limit {
+		last := docs[len(docs)-1].Ref
+		cursor := last.ID
+		if *qf.group {
+			cursor = strings.SplitN(last.Path, "/documents/", 2)[1]
+		}
+		fmt.Fprintf(e.stderr, "More documents may follow: -after %s\n", cursor)
+	}
+	return nil
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	fs := commandFlags(e, "get", getUsage)
+	deleted := fs.Bool("deleted", false, "print the document even if it is soft-deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("get needs a collection and a document ID")
+	}
+
+	scope, err := tenantScopeOf(ctx, fs.Arg(0), false)
+	if err != nil {
+		return err
+	}
+	col, err := collection(scope.path)
+	if err != nil {
+		return err
+	}
+	doc, err := col.Doc(fs.Arg(1)).Get(ctx)
+	if err != nil {
+		return err
+	}
+	if !scope.owns(doc) {
+		return fmt.Errorf("document '%s' not found for tenant '%s'", fs.Arg(1), scope.tenantID)
+	}
+	if isDeleted(doc) && !*deleted {
+		return fmt.Errorf("document '%s' is soft-deleted; use -deleted to print it", fs.Arg(1))
+	}
+
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(document(doc))
+}
+
+func isDeleted(doc *firestore.DocumentSnapshot) bool {
+	deleted, _ := doc.Data()["deleted"].(bool)
+	return deleted
+}
+
+func runCount(ctx context.Context, e *env, args []string) error {
+	fs := commandFlags(e, "count", countUsage)
+	qf := addQueryFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("count needs a collection")
+	}
+
+	query, err := qf.query(ctx, fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	result, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return err
+	}
+	count, ok := result["count"].(interface{ GetIntegerValue() int64 })
+	if !ok {
+		return fmt.Errorf("unexpected count result %v", result["count"])
+	}
+	fmt.Fprintln(e.stdout, count.GetIntegerValue())
+	return nil
+}
+
+func runExport(ctx context.Context, e *env, args []string) (err error) {
+	fs := commandFlags(e, "export", exportUsage)
+	qf := addQueryFlags(fs)
+	output := fs.String("o", "", "output file (standard output if empty)")
+	format := fs.String("format", "jsonl", "jsonl, or csv for a registered model")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("export needs a collection")
+	}
+	f, err := firegorm.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var export func(w io.Writer) (int, error)
+	if f == firegorm.CSV {
+		// CSV columns come from the model's fields.
+		model := pathModel(fs.Arg(0))
+		if model == nil || *qf.group {
+			if model, err = resolveModel(fs.Arg(0), "", *qf.group); err != nil {
+				return err
+			}
+		}
+		params, err := parseAssignments(fs.Args()[1:])
+		if err != nil {
+			return err
+		}
+		var opts []firegorm.TransferOption
+		if *qf.deleted {
+			opts = append(opts, firegorm.ExportIncludeDeleted())
+		}
+		if *qf.where != "" {
+			opts = append(opts, firegorm.ExportWhere(*qf.where))
+		}
+		export = func(w io.Writer) (int, error) {
+			return firegorm.Export(ctx, model, firegorm.ExtractFilters(params, nil), w, f, opts...)
+		}
+	} else {
+		query, err := qf.query(ctx, fs.Arg(0), fs.Args()[1:])
+		if err != nil {
+			return err
+		}
+		export = func(w io.Writer) (int, error) {
+			return exportJSONL(ctx, query, w)
+		}
+	}
+
+	var w io.Writer = e.stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = file
+	}
+
+	exported, err := export(w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Exported %d documents\n", exported)
+	return nil
+}
+
+// exportJSONL writes the raw documents of a query, one JSON object per line.
+func exportJSONL(ctx context.Context, query firestore.Query, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	exported := 0
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return exported, nil
+		}
+		if err != nil {
+			return exported, err
+		}
+		if err := enc.Encode(document(doc)); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+}
+
+func runImport(ctx context.Context, e *env, args []string) (err error) {
+	fs := commandFlags(e, "import", importUsage)
+	parents := fs.String("in", "", "comma-separated parent IDs of a subcollection")
+	format := fs.String("format", "jsonl", "jsonl or csv")
+	validate := fs.Bool("validate", false, "validate every record before writing")
+	batch := fs.Int("batch", 500, "documents written per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("import needs a model and a file")
+	}
+	f, err := firegorm.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	model, err := resolveModel(fs.Arg(0), *parents, false)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = e.stdin
+	if name := fs.Arg(1); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	opts := []firegorm.TransferOption{firegorm.ImportBatchSize(*batch)}
+	if *validate {
+		opts = append(opts, firegorm.ImportValidate())
+	}
+	imported, err := firegorm.Import(ctx, model, r, f, opts...)
+	fmt.Fprintf(e.stderr, "Imported %d documents\n", imported)
+	return err
+}
+
+// pathModel returns the registered model storing the collection at path,
+// bound to the parent IDs of the path, so writes run its validation and hooks
+// and CSV exports get its columns, or nil if there is none.
+func pathModel(path string) *firegorm.BaseModel {
+	name, _, parentIDs, ok := registered(path, false)
+	if !ok {
+		return nil
+	}
+	model, _ := firegorm.Model(name)
+	if len(parentIDs) > 0 {
+		model = model.In(parentIDs...)
+	}
+	return model
+}
+
+// registered finds the model registered for the collection at path, whose
+// template may have placeholders, e.g. "orders/{orderID}/items" for
+// "orders/o1/items", and returns the parent IDs they stand for. With group,
+// path is a collection ID matched against the last segment of the templates.
+func registered(path string, group bool) (string, firegorm.ModelInfo, []string, bool) {
+	for _, name := range firegorm.ListModels() {
+		info, err := firegorm.GetModelInfo(name)
+		if err != nil {
+			continue
+		}
+		if group {
+			segments := strings.Split(info.CollectionName, "/")
+			if segments[len(segments)-1] == path {
+				return name, info, nil, true
+			}
+			continue
+		}
+		if parentIDs, ok := matchTemplate(info.CollectionName, path); ok {
+			return name, info, parentIDs, true
+		}
+	}
+	return "", firegorm.ModelInfo{}, nil, false
+}
+
+// matchTemplate reports whether path fills the collection template, returning
+// the values of its placeholders in order.
+func matchTemplate(template, path string) ([]string, bool) {
+	want, got := strings.Split(template, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	var parentIDs []string
+	for i, segment := range want {
+		switch {
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			if got[i] == "" {
+				return nil, false
+			}
+			parentIDs = append(parentIDs, got[i])
+		case segment != got[i]:
+			return nil, false
+		}
+	}
+	return parentIDs, true
+}
+
+// docArgs parses the <collection> <id> arguments of the write commands.
+func docArgs(ctx context.Context, e *env, name, usage string, args []string, min int) (*flag.FlagSet, *firestore.DocumentRef, error) {
+	fs := commandFlags(e, name, usage)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() < min {
+		fs.Usage()
+		return nil, nil, fmt.Errorf("%s needs a collection and a document ID", name)
+	}
+	if pathModel(fs.Arg(0)) == nil {
+		// Writes through a model are scoped by it; raw writes cannot be.
+		if _, err := tenantScopeOf(ctx, fs.Arg(0), false); err != nil {
+			return nil, nil, err
+		}
+	}
+	col, err := collection(fs.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	return fs, col.Doc(fs.Arg(1)), nil
+}
+
+func runUpdate(ctx context.Context, e *env, args []string) error {
+	fs, ref, err := docArgs(ctx, e, "update", updateUsage, args, 3)
+	if err != nil {
+		return err
+	}
+	params, err := parseAssignments(fs.Args()[2:])
+	if err != nil {
+		return err
+	}
+	_, info, _, typed := registered(fs.Arg(0), false)
+	updates := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		switch key {
+		case "id", "created_at":
+			return fmt.Errorf("field '%s' cannot be updated", key)
+		}
+		if !typed {
+			updates[key] = updateValue(value)
+			continue
+		}
+		if updates[key], err = modelValue(info, key, value); err != nil {
+			return err
+		}
+	}
+
+	if model := pathModel(fs.Arg(0)); model != nil {
+		err = model.Update(ctx, ref.ID, updates)
+	} else {
+		err = rawUpdate(ctx, ref, updates)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Updated %s\n", ref.ID)
+	return nil
+}
+
+func runDelete(ctx context.Context, e *env, args []string) error {
+	fs, ref, err := docArgs(ctx, e, "delete", deleteUsage, args, 2)
+	if err != nil {
+		return err
+	}
+	if model := pathModel(fs.Arg(0)); model != nil {
+		err = model.Delete(ctx, ref.ID)
+	} else {
+		now := time.Now().UTC()
+		err = rawUpdate(ctx, ref, map[string]interface{}{"deleted": true, "deleted_at": now})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Deleted %s\n", ref.ID)
+	return nil
+}
+
+func runRestore(ctx context.Context, e *env, args []string) error {
+	fs, ref, err := docArgs(ctx, e, "restore", restoreUsage, args, 2)
+	if err != nil {
+		return err
+	}
+	if model := pathModel(fs.Arg(0)); model != nil {
+		err = model.Restore(ctx, ref.ID)
+	} else {
+		err = rawUpdate(ctx, ref, map[string]interface{}{"deleted": false, "deleted_at": nil})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "Restored %s\n", ref.ID)
+	return nil
+}
+
+// rawUpdate updates a document of a collection no model is registered for,
+// stamping updated_at. It fails if the document does not exist.
+func rawUpdate(ctx context.Context, ref *firestore.DocumentRef, updates map[string]interface{}) error {
+	fields := make([]firestore.Update, 0, len(updates)+1)
+	for key, value := range updates {
+		fields = append(fields, firestore.Update{Path: key, Value: value})
+	}
+	if _, ok := updates["updated_at"]; !ok {
+		fields = append(fields, firestore.Update{Path: "updated_at", Value: time.Now().UTC()})
+	}
+	_, err := ref.Update(ctx, fields)
+	return err
+}
@@ -0,0 +1,157 @@
+package firegorm
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Clock tells Firegorm the current time. Replace it in tests to get
+// predictable created_at, updated_at and deleted_at values.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the local system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// TimestampPolicy selects who sets the created_at, updated_at and deleted_at
+// fields of BaseModel.
+type TimestampPolicy int
+
+const (
+	// ClientTimestamps takes every timestamp from the Clock, in UTC. This is
+	// the default.
+	ClientTimestamps TimestampPolicy = iota
+	// ServerTimestamps lets Firestore set every timestamp to the commit time.
+	// On Create, the struct passed in receives the Clock time, which may
+	// differ slightly from the stored value.
+	ServerTimestamps
+)
+
+// String returns the policy name.
+func (p TimestampPolicy) String() string {
+	if p == ServerTimestamps {
+		return "server"
+	}
+	return "client"
+}
+
+var clock = guarded[Clock]{v: systemClock{}}
+var timestampPolicy guarded[TimestampPolicy]
+
+// SetClock replaces the clock of the default DB. Passing nil restores the
+// system clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clock.store(c)
+}
+
+// SetTimestampPolicy selects how the default DB sets BaseModel timestamps.
+func SetTimestampPolicy(p TimestampPolicy) {
+	timestampPolicy.store(p)
+}
+
+// SetClock replaces the clock of the DB. Passing nil restores the system clock.
+func (db *DB) SetClock(c Clock) {
+	if db == defaultDB {
+		SetClock(c)
+		return
+	}
+	if c == nil {
+		c = systemClock{}
+	}
+	db.clock.store(c)
+}
+
+// SetTimestampPolicy selects how the DB sets BaseModel timestamps.
+func (db *DB) SetTimestampPolicy(p TimestampPolicy) {
+	if db == defaultDB {
+		SetTimestampPolicy(p)
+		return
+	}
+	db.timestamps.store(p)
+}
+
+// now returns the current time of the DB's clock in UTC.
+func (db *DB) now() time.Time {
+	c := db.clock.load()
+	if db == defaultDB || c == nil {
+		c = clock.load()
+	}
+	return c.Now().UTC()
+}
+
+// timestampPolicy returns the timestamp policy of the DB.
+func (db *DB) timestampPolicy() TimestampPolicy {
+	if db == defaultDB {
+		return timestampPolicy.load()
+	}
+	return db.timestamps.load()
+}
+
+// timestamp returns the value written to a timestamp field on update: the
+// Firestore server timestamp sentinel or the current clock time.
+func (db *DB) timestamp() interface{} {
+	if db.timestampPolicy() == ServerTimestamps {
+		return firestore.ServerTimestamp
+	}
+	return db.now()
+}
+
+// createDoc writes a new document. With ServerTimestamps the created_at and
+// updated_at fields are written as the commit time, in the same write.
+func (db *DB) createDoc(ctx context.Context, ref *firestore.DocumentRef, data interface{}) error {
+	if db.timestampPolicy() != ServerTimestamps {
+		_, err := ref.Set(ctx, data)
+		return err
+	}
+	fields := make(map[string]interface{})
+	storedFields(reflect.Indirect(reflect.ValueOf(data)), fields)
+	fields["created_at"] = firestore.ServerTimestamp
+	fields["updated_at"] = firestore.ServerTimestamp
+	_, err := ref.Set(ctx, fields)
+	return err
+}
+
+// storedFields copies the persisted fields of a document struct into out,
+// keyed by their Firestore name, as Set would store them: embedded structs
+// are flattened and the omitempty and serverTimestamp tag options apply.
+func storedFields(v reflect.Value, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("firestore"), ",")
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			storedFields(v.Field(i), out)
+			continue
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value := v.Field(i)
+		switch {
+		case value.IsZero() && slices.Contains(strings.Split(options, ","), "omitempty"):
+			continue
+		case value.IsZero() && slices.Contains(strings.Split(options, ","), "serverTimestamp"):
+			out[name] = firestore.ServerTimestamp
+		default:
+			out[name] = value.Interface()
+		}
+	}
+}
@@ -0,0 +1,34 @@
+// Command firegorm inspects and manages Firestore collections.
+//
+//	firegorm -emulator localhost:8080 -project demo models
+//
+// Run "firegorm" without arguments for the list of commands.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/GEMSDEV-mx/firegorm"
+	"github.com/GEMSDEV-mx/firegorm/cli"
+)
+
+func main() {
+	// Only errors are logged unless FIREGORM_LOG_LEVEL asks for more.
+	level := os.Getenv("FIREGORM_LOG_LEVEL")
+	if level == "" {
+		level = "ERROR"
+	}
+	firegorm.SetLogLevel(level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cli.Run(ctx, os.Args[1:], cli.Options{}); err != nil {
+		fmt.Fprintln(os.Stderr, "firegorm:", err)
+		stop()
+		os.Exit(1)
+	}
+}
@@ -2,34 +2,176 @@ package firegorm
 
 import (
 	"context"
+	"errors"
+	"os"
 
 	"cloud.google.com/go/firestore"
-	firebase "firebase.google.com/go/v4"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 var Client *firestore.Client
 
+// emulatorConn is the connection opened for the Firestore emulator, if any.
+var emulatorConn *grpc.ClientConn
+
+// emulatorProjectID is used against the emulator when no project ID is configured.
+const emulatorProjectID = "demo-firegorm"
+
+// Config configures the Firestore client created by InitWithConfig.
+type Config struct {
+	// ProjectID is the Google Cloud project. When empty it is detected from
+	// the credentials or the environment.
+	ProjectID string
+	// DatabaseID selects a named Firestore database. When empty the
+	// "(default)" database is used.
+	DatabaseID string
+	// EmulatorHost is the host:port of a Firestore emulator. When empty the
+	// FIRESTORE_EMULATOR_HOST environment variable is honoured.
+	EmulatorHost string
+	// Credentials is a service account key as a JSON string. When empty,
+	// Application Default Credentials are used.
+	Credentials string
+	// ClientOptions are passed to the Firestore client as is, e.g.
+	// option.WithCredentialsFile or option.WithEndpoint.
+	ClientOptions []option.ClientOption
+
+	// Logger, TracerProvider and Metrics, when set, are installed as with
+	// SetLogger, SetTracerProvider and SetMetrics.
+	Logger         Logger
+	TracerProvider trace.TracerProvider
+	Metrics        Metrics
+
+	// Clock, when set, provides the time for BaseModel timestamps.
+	Clock Clock
+	// Timestamps selects whether timestamps come from the Clock or from the
+	// Firestore server. InitWithConfig only changes the policy when it is set
+	// to ServerTimestamps, as the zero value cannot be told from unset.
+	Timestamps TimestampPolicy
+}
+
 // Init initializes the Firestore client and logger.
 // The credentials should be passed as a JSON string.
 func Init(credentialsJSON string) error {
-	InitializeLogger() // Set up logging
-
-	ctx := context.Background()
-	sa := option.WithCredentialsJSON([]byte(credentialsJSON))
+	return InitWithConfig(Config{Credentials: credentialsJSON})
+}
 
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		Log(ERROR, "Failed to initialize Firebase App: %v", err)
-		return err
+// InitWithConfig initializes the Firestore client from cfg. Use it to connect
+// to the emulator, a named database, or with Application Default Credentials.
+func InitWithConfig(cfg Config) error {
+	if level := os.Getenv("FIREGORM_LOG_LEVEL"); level != "" {
+		SetLogLevel(level)
+	}
+	if cfg.Logger != nil {
+		SetLogger(cfg.Logger)
+	}
+	if cfg.TracerProvider != nil {
+		SetTracerProvider(cfg.TracerProvider)
+	}
+	if cfg.Metrics != nil {
+		SetMetrics(cfg.Metrics)
+	}
+	if cfg.Clock != nil {
+		SetClock(cfg.Clock)
+	}
+	if cfg.Timestamps != ClientTimestamps {
+		SetTimestampPolicy(cfg.Timestamps)
 	}
 
-	Client, err = app.Firestore(ctx)
+	client, conn, err := newFirestoreClient(context.Background(), cfg)
 	if err != nil {
 		Log(ERROR, "Failed to initialize Firestore client: %v", err)
 		return err
 	}
 
+	Client, emulatorConn = client, conn
 	Log(INFO, "Firestore client successfully initialized")
 	return nil
 }
+
+// newFirestoreClient creates a client from cfg. The returned connection is
+// only set when connecting to the emulator and must be closed with the client.
+func newFirestoreClient(ctx context.Context, cfg Config) (*firestore.Client, *grpc.ClientConn, error) {
+	projectID := cfg.ProjectID
+	opts := append([]option.ClientOption(nil), cfg.ClientOptions...)
+
+	emulatorHost := cfg.EmulatorHost
+	if emulatorHost == "" {
+		emulatorHost = os.Getenv("FIRESTORE_EMULATOR_HOST")
+	}
+
+	var conn *grpc.ClientConn
+	if emulatorHost != "" {
+		var err error
+		conn, err = grpc.NewClient(emulatorHost,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithPerRPCCredentials(emulatorCredentials{}),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, option.WithGRPCConn(conn))
+		if projectID == "" {
+			projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+		if projectID == "" {
+			projectID = emulatorProjectID
+		}
+		logf(ctx, INFO, "Connecting to Firestore emulator at %s", emulatorHost)
+	} else if cfg.Credentials != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(cfg.Credentials)))
+	}
+
+	if projectID == "" {
+		projectID = firestore.DetectProjectID
+	}
+
+	var client *firestore.Client
+	var err error
+	if cfg.DatabaseID == "" || cfg.DatabaseID == firestore.DefaultDatabaseID {
+		client, err = firestore.NewClient(ctx, projectID, opts...)
+	} else {
+		client, err = firestore.NewClientWithDatabase(ctx, projectID, cfg.DatabaseID, opts...)
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// Close releases the Firestore client created by Init or InitWithConfig.
+func Close() error {
+	if Client == nil {
+		return errors.New("firestore client is not initialized")
+	}
+
+	err := Client.Close()
+	if emulatorConn != nil {
+		emulatorConn.Close()
+	}
+	Client, emulatorConn = nil, nil
+
+	if err != nil {
+		Log(ERROR, "Failed to close Firestore client: %v", err)
+		return err
+	}
+	Log(INFO, "Firestore client closed")
+	return nil
+}
+
+// emulatorCredentials authenticates as an admin against the Firestore
+// emulator, which accepts the fixed "Bearer owner" token.
+type emulatorCredentials struct{}
+
+func (emulatorCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer owner"}, nil
+}
+
+func (emulatorCredentials) RequireTransportSecurity() bool {
+	return false
+}
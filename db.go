@@ -0,0 +1,204 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+)
+
+// DB is a Firestore connection together with the models, hooks and logger
+// that use it. Several DBs can be open at the same time, e.g. to talk to two
+// projects or to run isolated tests in parallel.
+//
+// The package-level API (Init, RegisterModel, DefaultRegistry, SetLogger, ...)
+// operates on the default DB returned by Default.
+type DB struct {
+	client *firestore.Client
+	conn   *grpc.ClientConn // Emulator connection, closed with the client
+	models *ModelRegistry
+	hooks  *HookRegistry
+	logger Logger
+
+	clock      guarded[Clock]
+	timestamps guarded[TimestampPolicy]
+}
+
+// defaultDB stands for the package-level globals Client, modelRegistry,
+// DefaultRegistry and logger, which it reads on every use.
+var defaultDB = &DB{}
+
+// guarded holds a package-level setting that may be replaced while
+// operations read it.
+type guarded[T any] struct {
+	mu sync.RWMutex
+	v  T
+}
+
+func (g *guarded[T]) load() T {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.v
+}
+
+func (g *guarded[T]) store(v T) {
+	g.mu.Lock()
+	g.v = v
+	g.mu.Unlock()
+}
+
+// Default returns the DB backed by the package-level globals.
+func Default() *DB {
+	return defaultDB
+}
+
+// Open creates a DB with its own Firestore client, model registry and hook
+// registry. cfg.Logger becomes the DB's logger; when nil, the package logger
+// is used. cfg.Clock and cfg.Timestamps apply to this DB only. Tracing and
+// metrics are process-wide and are not set by Open; use SetTracerProvider and
+// SetMetrics instead.
+func Open(cfg Config) (*DB, error) {
+	client, conn, err := newFirestoreClient(context.Background(), cfg)
+	if err != nil {
+		Log(ERROR, "Failed to open Firestore client: %v", err)
+		return nil, err
+	}
+
+	db := &DB{
+		client: client,
+		conn:   conn,
+		models: NewModelRegistry(),
+		hooks:  NewHookRegistry(),
+		logger: cfg.Logger,
+	}
+	db.clock.store(cfg.Clock)
+	db.timestamps.store(cfg.Timestamps)
+	db.Log(INFO, "Firestore client successfully opened")
+	return db, nil
+}
+
+// Client returns the Firestore client of the DB, or nil once it is closed.
+func (db *DB) Client() *firestore.Client {
+	if db == defaultDB {
+		return Client
+	}
+	return db.client
+}
+
+// Hooks returns the hook registry run by the DB's models.
+func (db *DB) Hooks() *HookRegistry {
+	if db == defaultDB {
+		return DefaultRegistry
+	}
+	return db.hooks
+}
+
+// SetLogger replaces the logger of the DB. Passing nil makes it use the
+// package logger again.
+func (db *DB) SetLogger(l Logger) {
+	if db == defaultDB {
+		SetLogger(l)
+		return
+	}
+	logState.Lock()
+	db.logger = l
+	logState.Unlock()
+}
+
+// Log logs a message to the DB's logger, based on the current logging level.
+func (db *DB) Log(level LogLevel, format string, v ...interface{}) {
+	db.logf(context.Background(), level, format, v...)
+}
+
+// logf is Log for code running on behalf of a caller, whose ctx reaches the
+// logger along with the request ID it carries.
+func (db *DB) logf(ctx context.Context, level LogLevel, format string, v ...interface{}) {
+	l, threshold := db.currentLogger()
+	if level >= threshold {
+		l.Log(ctx, level, fmt.Sprintf(format, v...), requestAttrs(ctx)...)
+	}
+}
+
+// logCtx writes a structured entry to the DB's logger, adding the request ID
+// carried by ctx, if any.
+func (db *DB) logCtx(ctx context.Context, level LogLevel, msg string, attrs ...Attr) {
+	l, threshold := db.currentLogger()
+	if level >= threshold {
+		l.Log(ctx, level, msg, append(attrs, requestAttrs(ctx)...)...)
+	}
+}
+
+// currentLogger returns the logger of the DB and the current logging level.
+func (db *DB) currentLogger() (Logger, LogLevel) {
+	logState.RLock()
+	defer logState.RUnlock()
+	if db == defaultDB || db.logger == nil {
+		return logState.logger, logState.level
+	}
+	return db.logger, logState.level
+}
+
+// requestAttrs returns the request ID carried by ctx as a log attribute.
+func requestAttrs(ctx context.Context) []Attr {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return []Attr{{Key: "request_id", Value: id}}
+	}
+	return nil
+}
+
+// registry returns the models registered with the DB.
+func (db *DB) registry() *ModelRegistry {
+	if db == defaultDB {
+		return modelRegistry
+	}
+	return db.models
+}
+
+// Close releases the Firestore client of the DB.
+func (db *DB) Close() error {
+	if db == defaultDB {
+		return Close()
+	}
+	if db.client == nil {
+		return errors.New("firestore client is not initialized")
+	}
+
+	err := db.client.Close()
+	if db.conn != nil {
+		db.conn.Close()
+	}
+	db.client, db.conn = nil, nil
+
+	if err != nil {
+		db.Log(ERROR, "Failed to close Firestore client: %v", err)
+		return err
+	}
+	db.Log(INFO, "Firestore client closed")
+	return nil
+}
+
+// database returns the DB the model was registered with.
+func (b *BaseModel) database() *DB {
+	if b.db == nil {
+		return defaultDB
+	}
+	return b.db
+}
+
+// setDB binds the model to the DB it is registered with.
+func (b *BaseModel) setDB(db *DB) {
+	b.db = db
+}
+
+// log logs a message to the logger of the model's DB.
+func (b *BaseModel) log(level LogLevel, format string, v ...interface{}) {
+	b.database().Log(level, format, v...)
+}
+
+// logf is log for operations, passing their ctx on to the logger.
+func (b *BaseModel) logf(ctx context.Context, level LogLevel, format string, v ...interface{}) {
+	b.database().logf(ctx, level, format, v...)
+}
@@ -0,0 +1,99 @@
+package firegorm
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ModelDescription describes a registered model, e.g. for documentation,
+// admin tooling or schema checks.
+type ModelDescription struct {
+	Name       string             `json:"name"`
+	Collection string             `json:"collection"`
+	Type       string             `json:"type"`
+	Fields     []FieldDescription `json:"fields"`
+}
+
+// FieldDescription describes a field of a registered model. Fields of
+// embedded structs such as BaseModel are listed as fields of the model.
+type FieldDescription struct {
+	Name      string    `json:"name"`                // Go field name
+	Type      string    `json:"type"`                // Go type, e.g. "*time.Time"
+	Firestore string    `json:"firestore,omitempty"` // Stored field name; empty for relation fields
+	JSON      string    `json:"json,omitempty"`
+	Tag       string    `json:"tag,omitempty"`      // Full struct tag
+	Validate  []string  `json:"validate,omitempty"` // Rules of the validate tag, e.g. ["required"]
+	Sensitive bool      `json:"sensitive,omitempty"`
+	Relation  *Relation `json:"relation,omitempty"`
+}
+
+// Describe returns the models registered with the default DB.
+func Describe() []ModelDescription {
+	return defaultDB.Describe()
+}
+
+// Describe returns every registered model with its fields, types, tags and
+// validation rules, sorted by model name.
+func (db *DB) Describe() []ModelDescription {
+	models := db.registry()
+	var descriptions []ModelDescription
+	for _, name := range models.names() {
+		info, ok := models.get(name)
+		if !ok {
+			continue
+		}
+		descriptions = append(descriptions, ModelDescription{
+			Name:       name,
+			Collection: info.CollectionName,
+			Type:       info.Schema.String(),
+			Fields:     describeFields(info.Schema, info.Relations),
+		})
+	}
+	return descriptions
+}
+
+// describeFields lists the persisted and relation fields of t, flattening
+// embedded structs.
+func describeFields(t reflect.Type, relations map[string]Relation) []FieldDescription {
+	var fields []FieldDescription
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, describeFields(field.Type, relations)...)
+			continue
+		}
+
+		desc := FieldDescription{
+			Name:      field.Name,
+			Type:      field.Type.String(),
+			JSON:      tagName(field.Tag.Get("json")),
+			Tag:       string(field.Tag),
+			Sensitive: isSensitiveField(field),
+		}
+		if rel, ok := relations[field.Name]; ok {
+			desc.Relation = &rel
+		} else {
+			name := tagName(field.Tag.Get("firestore"))
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			desc.Firestore = name
+		}
+		if rules := field.Tag.Get("validate"); rules != "" {
+			desc.Validate = strings.Split(rules, ",")
+		}
+		fields = append(fields, desc)
+	}
+	return fields
+}
+
+// tagName returns the name part of a firestore or json struct tag.
+func tagName(tag string) string {
+	return strings.SplitN(tag, ",", 2)[0]
+}
@@ -0,0 +1,46 @@
+package firegorm
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNotFound is matched, with errors.Is, by the errors of reads on documents
+// that do not exist or are soft deleted. Use IsNotFound to also catch the
+// NotFound status Firestore returns for missing documents.
+var ErrNotFound = errors.New("document not found")
+
+// IsNotFound reports whether err means the document does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || status.Code(err) == codes.NotFound
+}
+
+// notFoundError is a descriptive error matching ErrNotFound.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string { return e.msg }
+
+func (e *notFoundError) Is(target error) bool { return target == ErrNotFound }
+
+func notFound(format string, args ...interface{}) error {
+	return &notFoundError{msg: fmt.Sprintf(format, args...)}
+}
+
+// ValidationError reports input rejected before reaching Firestore: data
+// failing ValidateStruct, unknown or empty update fields, and malformed
+// filters, sort specifications, selected fields or page tokens.
+type ValidationError struct {
+	Field   string // Field or parameter at fault, if any
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,413 @@
+package firegorm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/firestore"
+)
+
+// FilterExprError reports a filter expression that cannot be parsed, with
+// the position of the offending token.
+type FilterExprError struct {
+	Expr    string
+	Pos     int    // Byte offset of the offending token in Expr
+	Token   string // Offending token; empty at the end of the expression
+	Message string
+}
+
+func (e *FilterExprError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("invalid filter expression: %s at end of input", e.Message)
+	}
+	return fmt.Sprintf("invalid filter expression: %s at position %d near '%s'", e.Message, e.Pos+1, e.Token)
+}
+
+// ParseFilterExpr parses a filter expression such as
+//
+//	status in ("open", "blocked") and due_date < 2025-05-01 and (owner == "a" or owner == "b")
+//
+// into a Firestore filter. Comparisons use ==, !=, <, <=, >, >=, in (...),
+// not in (...), contains and contains any (...), and are combined with and,
+// or and parentheses; and binds tighter than or. Quoted values are strings.
+// Unquoted values are numbers, true, false, null, dates and, for == and !=,
+// plain words, converted as in List filters: a date such as 2025-05-01
+// compared with < or <= covers the whole day.
+func ParseFilterExpr(expr string) (firestore.EntityFilter, error) {
+	tokens, err := lexFilterExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{expr: expr, tokens: tokens}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorAt(tok, "expected 'and', 'or' or the end of the expression")
+	}
+	return filter, nil
+}
+
+// ApplyFilterExpr parses a filter expression with ParseFilterExpr and adds it
+// to a Firestore query.
+func ApplyFilterExpr(query firestore.Query, expr string) (firestore.Query, error) {
+	filter, err := ParseFilterExpr(expr)
+	if err != nil {
+		return query, err
+	}
+	return applyEntityFilter(query, filter), nil
+}
+
+// applyWhere adds the expressions and filters given with Where and
+// WhereFilter to a query.
+func applyWhere(query firestore.Query, options queryOptions) (firestore.Query, error) {
+	for _, expr := range options.where {
+		var err error
+		if query, err = ApplyFilterExpr(query, expr); err != nil {
+			return query, err
+		}
+	}
+	for _, filter := range options.whereFilters {
+		query = applyEntityFilter(query, filter)
+	}
+	return query, nil
+}
+
+// applyEntityFilter adds a parsed filter to a query. Conjunctions of
+// comparisons become separate Where clauses, the structure
+// applyOperatorFilters builds for a filters map.
+func applyEntityFilter(query firestore.Query, filter firestore.EntityFilter) firestore.Query {
+	switch f := filter.(type) {
+	case firestore.PropertyFilter:
+		return query.Where(f.Path, f.Operator, f.Value)
+	case firestore.AndFilter:
+		for _, child := range f.Filters {
+			query = applyEntityFilter(query, child)
+		}
+		return query
+	default:
+		return query.WhereEntity(filter)
+	}
+}
+
+// mapFilterFields rewrites the field paths of a parsed filter with fn.
+func mapFilterFields(filter firestore.EntityFilter, fn func(string) (string, error)) (firestore.EntityFilter, error) {
+	switch f := filter.(type) {
+	case firestore.PropertyFilter:
+		path, err := fn(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.Path = path
+		return f, nil
+	case firestore.AndFilter:
+		children, err := mapFilterChildren(f.Filters, fn)
+		return firestore.AndFilter{Filters: children}, err
+	case firestore.OrFilter:
+		children, err := mapFilterChildren(f.Filters, fn)
+		return firestore.OrFilter{Filters: children}, err
+	}
+	return filter, nil
+}
+
+func mapFilterChildren(filters []firestore.EntityFilter, fn func(string) (string, error)) ([]firestore.EntityFilter, error) {
+	children := make([]firestore.EntityFilter, len(filters))
+	for i, child := range filters {
+		var err error
+		if children[i], err = mapFilterFields(child, fn); err != nil {
+			return nil, err
+		}
+	}
+	return children, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string // Source text of the token
+	val  string // Unquoted value of string tokens
+	pos  int
+}
+
+// isWordRune reports whether r can appear in a field name or unquoted value,
+// which includes the characters of dates and timestamps.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-+:", r)
+}
+
+func lexFilterExpr(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expr); {
+		r, start := rune(expr[i]), i
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '(':
+			tokens = append(tokens, exprToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, exprToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, exprToken{kind: tokComma, text: ",", pos: i})
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			i++
+			for ; i < len(expr) && rune(expr[i]) != r; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				b.WriteByte(expr[i])
+			}
+			if i == len(expr) {
+				return nil, &FilterExprError{Expr: expr, Pos: start, Token: expr[start:], Message: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: tokString, text: expr[start:i], val: b.String(), pos: start})
+		case strings.ContainsRune("=!<>", r):
+			n := 1
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				n = 2
+			}
+			op := expr[i : i+n]
+			i += n
+			switch op {
+			case "!":
+				return nil, &FilterExprError{Expr: expr, Pos: start, Token: op, Message: "unknown operator, use !="}
+			case "=":
+				tokens = append(tokens, exprToken{kind: tokOp, text: op, val: "==", pos: start})
+			default:
+				tokens = append(tokens, exprToken{kind: tokOp, text: op, val: op, pos: start})
+			}
+		default:
+			for i < len(expr) {
+				c, size := utf8.DecodeRuneInString(expr[i:])
+				if !isWordRune(c) {
+					break
+				}
+				i += size
+			}
+			if i == start {
+				c, _ := utf8.DecodeRuneInString(expr[i:])
+				return nil, &FilterExprError{Expr: expr, Pos: start, Token: string(c), Message: "unexpected character"}
+			}
+			tokens = append(tokens, exprToken{kind: tokWord, text: expr[start:i], pos: start})
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(expr)}), nil
+}
+
+// exprParser is a recursive descent parser over the tokens of a filter
+// expression:
+//
+//	or         = and { "or" and }
+//	and        = term { "and" term }
+//	term       = "(" or ")" | comparison
+//	comparison = field op value | field ["not"] "in" list
+//	           | field "contains" value | field "contains" "any" list
+//	list       = "(" value { "," value } ")"
+type exprParser struct {
+	expr   string
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword reports whether tok is the given keyword, in any case.
+func keyword(tok exprToken, word string) bool {
+	return tok.kind == tokWord && strings.EqualFold(tok.text, word)
+}
+
+func (p *exprParser) errorAt(tok exprToken, format string, args ...interface{}) error {
+	return &FilterExprError{Expr: p.expr, Pos: tok.pos, Token: tok.text, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (firestore.EntityFilter, error) {
+	return p.parseChain("or", p.parseAnd, func(filters []firestore.EntityFilter) firestore.EntityFilter {
+		return firestore.OrFilter{Filters: filters}
+	})
+}
+
+func (p *exprParser) parseAnd() (firestore.EntityFilter, error) {
+	return p.parseChain("and", p.parseTerm, func(filters []firestore.EntityFilter) firestore.EntityFilter {
+		return firestore.AndFilter{Filters: filters}
+	})
+}
+
+// parseChain parses operands separated by a keyword, combining them with
+// combine when there are several. Nested chains of the same kind, as in
+// a and (b and c), are flattened.
+func (p *exprParser) parseChain(word string, operand func() (firestore.EntityFilter, error), combine func([]firestore.EntityFilter) firestore.EntityFilter) (firestore.EntityFilter, error) {
+	var filters []firestore.EntityFilter
+	for {
+		filter, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if and, ok := filter.(firestore.AndFilter); ok && word == "and" {
+			filters = append(filters, and.Filters...)
+		} else if or, ok := filter.(firestore.OrFilter); ok && word == "or" {
+			filters = append(filters, or.Filters...)
+		} else {
+			filters = append(filters, filter)
+		}
+		if !keyword(p.peek(), word) {
+			break
+		}
+		p.next()
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return combine(filters), nil
+}
+
+func (p *exprParser) parseTerm() (firestore.EntityFilter, error) {
+	tok := p.peek()
+	if tok.kind == tokLParen {
+		p.next()
+		filter, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, p.errorAt(closing, "expected ')' to close the '(' at position %d", tok.pos+1)
+		}
+		return filter, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (firestore.EntityFilter, error) {
+	field := p.next()
+	if field.kind != tokWord || keyword(field, "and") || keyword(field, "or") {
+		return nil, p.errorAt(field, "expected a field name")
+	}
+
+	tok := p.next()
+	switch {
+	case tok.kind == tokOp:
+		value, err := p.parseValue(tok.val)
+		if err != nil {
+			return nil, err
+		}
+		return firestore.PropertyFilter{Path: field.text, Operator: tok.val, Value: value}, nil
+	case keyword(tok, "in"):
+		values, err := p.parseList("==")
+		if err != nil {
+			return nil, err
+		}
+		return firestore.PropertyFilter{Path: field.text, Operator: "in", Value: values}, nil
+	case keyword(tok, "not"):
+		if in := p.next(); !keyword(in, "in") {
+			return nil, p.errorAt(in, "expected 'in' after 'not'")
+		}
+		values, err := p.parseList("==")
+		if err != nil {
+			return nil, err
+		}
+		return firestore.PropertyFilter{Path: field.text, Operator: "not-in", Value: values}, nil
+	case keyword(tok, "contains"):
+		if keyword(p.peek(), "any") {
+			p.next()
+			values, err := p.parseList("==")
+			if err != nil {
+				return nil, err
+			}
+			return firestore.PropertyFilter{Path: field.text, Operator: "array-contains-any", Value: values}, nil
+		}
+		value, err := p.parseValue("==")
+		if err != nil {
+			return nil, err
+		}
+		return firestore.PropertyFilter{Path: field.text, Operator: "array-contains", Value: value}, nil
+	}
+	return nil, p.errorAt(tok, "expected an operator after '%s': ==, !=, <, <=, >, >=, in, not in or contains", field.text)
+}
+
+// parseList parses a parenthesized, comma-separated list of values.
+func (p *exprParser) parseList(op string) ([]interface{}, error) {
+	if open := p.next(); open.kind != tokLParen {
+		return nil, p.errorAt(open, "expected '(' to start a list of values")
+	}
+	var values []interface{}
+	for {
+		value, err := p.parseValue(op)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		tok := p.next()
+		if tok.kind == tokRParen {
+			return values, nil
+		}
+		if tok.kind != tokComma {
+			return nil, p.errorAt(tok, "expected ',' or ')' in a list of values")
+		}
+	}
+}
+
+// parseValue parses the value compared with op. Unquoted values are
+// converted like the string values of List filters.
+func (p *exprParser) parseValue(op string) (interface{}, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == tokString:
+		return tok.val, nil
+	case tok.kind != tokWord:
+		return nil, p.errorAt(tok, "expected a value")
+	case keyword(tok, "null"):
+		return nil, nil
+	}
+
+	value := parseValue(tok.text)
+	switch v := value.(type) {
+	case time.Time:
+		if len(tok.text) == len("2006-01-02") {
+			// As in parseFilter, date-only upper bounds include the whole day.
+			switch op {
+			case "<=":
+				v = v.Add(24*time.Hour - time.Nanosecond)
+			case "<":
+				v = v.Add(24 * time.Hour)
+			}
+		}
+		return v, nil
+	case string:
+		if keyword(tok, "and") || keyword(tok, "or") {
+			return nil, p.errorAt(tok, "expected a value")
+		}
+		if op != "==" && op != "!=" {
+			return nil, p.errorAt(tok, "invalid value for '%s': expected a number or date, quote strings", op)
+		}
+		return v, nil
+	}
+	return value, nil
+}
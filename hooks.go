@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HookType covers all supported events.
@@ -87,7 +90,13 @@ func (r *HookRegistry) EnableScope(collection string, ht HookType, on bool) {
 }
 
 // runHooks executes, in order, all enabled hooks for this point.
-func (r *HookRegistry) RunHooks(ctx context.Context, collection string, ht HookType, data interface{}) error {
+func (r *HookRegistry) RunHooks(ctx context.Context, collection string, ht HookType, data interface{}) (err error) {
+    ctx, span := tracer.load().Start(ctx, "firegorm.hooks."+string(ht), trace.WithAttributes(
+        attribute.String("firegorm.collection", collection),
+        attribute.String("firegorm.hook_type", string(ht)),
+    ))
+    defer func() { endSpan(span, err) }()
+
     r.mu.RLock()
     defer r.mu.RUnlock()
 
@@ -106,6 +115,7 @@ func (r *HookRegistry) RunHooks(ctx context.Context, collection string, ht HookT
 
     // grab the slice
     fns := r.hooks[collection][ht]
+    span.SetAttributes(attribute.Int("firegorm.hook_count", len(fns)))
     for _, fn := range fns {
         if err := fn(ctx, data); err != nil {
             return fmt.Errorf("hook %s on %s failed: %w", ht, collection, err)
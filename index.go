@@ -0,0 +1,260 @@
+package firegorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// IndexField is a field of a composite index.
+type IndexField struct {
+	Field         string
+	Direction     firestore.Direction // Ignored for array-contains fields
+	ArrayContains bool
+}
+
+// String returns the field in the notation accepted by WithIndex.
+func (f IndexField) String() string {
+	if f.ArrayContains {
+		return f.Field + ":contains"
+	}
+	return SortField{Field: f.Field, Direction: f.Direction}.String()
+}
+
+// Index is a Firestore composite index.
+type Index struct {
+	Collection string // Collection ID, i.e. the last segment of the collection path
+	Group      bool   // Collection group scope instead of collection scope
+	Fields     []IndexField
+}
+
+// String returns a readable form of the index, e.g. "tasks(deleted,status,-created_at)".
+func (ix Index) String() string {
+	fields := make([]string, len(ix.Fields))
+	for i, f := range ix.Fields {
+		fields[i] = f.String()
+	}
+	s := ix.Collection + "(" + strings.Join(fields, ",") + ")"
+	if ix.Group {
+		s += " [group]"
+	}
+	return s
+}
+
+// WithIndex declares a composite index for the model. Fields use the sort
+// notation ("-created_at" is descending) and "tags:contains" declares an
+// array-contains field. Every query filters on "deleted", so the index is
+// prefixed with it unless it is listed explicitly.
+func WithIndex(fields ...string) ModelOption {
+	return withIndex(false, fields)
+}
+
+// WithGroupIndex is like WithIndex for queries on the collection group.
+func WithGroupIndex(fields ...string) ModelOption {
+	return withIndex(true, fields)
+}
+
+func withIndex(group bool, specs []string) ModelOption {
+	return func(info *ModelInfo) error {
+		var fields []IndexField
+		for _, spec := range specs {
+			field, err := parseIndexField(spec)
+			if err != nil {
+				return err
+			}
+			if _, ok := info.TagToFieldMap[field.Field]; !ok && !baseFieldNames[field.Field] {
+				return fmt.Errorf("index field '%s' does not exist in the model", field.Field)
+			}
+			fields = append(fields, field)
+		}
+		ix, err := modelIndex(info.CollectionName, group, fields)
+		if err != nil {
+			return err
+		}
+		info.Indexes = append(info.Indexes, ix)
+		return nil
+	}
+}
+
+// parseIndexField parses a single WithIndex field.
+func parseIndexField(spec string) (IndexField, error) {
+	spec = strings.TrimSpace(spec)
+	if name, ok := strings.CutSuffix(spec, ":contains"); ok {
+		if name == "" {
+			return IndexField{}, fmt.Errorf("invalid index field %q: missing field name", spec)
+		}
+		return IndexField{Field: name, ArrayContains: true}, nil
+	}
+	sorted, err := ParseSort(spec)
+	if err != nil {
+		return IndexField{}, err
+	}
+	if len(sorted) != 1 {
+		return IndexField{}, fmt.Errorf("invalid index field %q: expected a single field", spec)
+	}
+	return IndexField{Field: sorted[0].Field, Direction: sorted[0].Direction}, nil
+}
+
+// modelIndex builds an index of a model's collection, prefixed with the
+// "deleted" field every query filters on.
+func modelIndex(collectionName string, group bool, fields []IndexField) (Index, error) {
+	if len(fields) == 0 {
+		return Index{}, fmt.Errorf("index on collection '%s' has no fields", collectionName)
+	}
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if seen[f.Field] {
+			return Index{}, fmt.Errorf("index field '%s' is repeated", f.Field)
+		}
+		seen[f.Field] = true
+	}
+	if !seen["deleted"] {
+		fields = append([]IndexField{{Field: "deleted", Direction: firestore.Asc}}, fields...)
+	}
+	return Index{Collection: collectionID(collectionName), Group: group, Fields: fields}, nil
+}
+
+// collectionID returns the last segment of a collection path.
+func collectionID(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// parseIndexTags builds the indexes declared with `firegorm:"index:name"`
+// tags. Fields sharing an index name form one index, in struct field order.
+// The options order=desc and array=contains set how a field is indexed.
+func parseIndexTags(modelType reflect.Type, collectionName string) ([]Index, error) {
+	var names []string
+	fields := make(map[string][]IndexField)
+	for i := 0; i < modelType.NumField(); i++ {
+		field := modelType.Field(i)
+		for _, d := range parseFiregormTag(field.Tag.Get("firegorm")) {
+			if d.Name != "index" {
+				continue
+			}
+			if d.Value == "" {
+				return nil, fmt.Errorf("index tag on field '%s' must name the index, e.g. index:by_status", field.Name)
+			}
+
+			name := tagName(field.Tag.Get("firestore"))
+			if name == "" {
+				name = field.Name
+			}
+			f := IndexField{Field: name, Direction: firestore.Asc}
+			switch {
+			case d.Options["array"] == "contains":
+				f.ArrayContains = true
+			case d.Options["order"] == "desc":
+				f.Direction = firestore.Desc
+			case d.Options["order"] != "" && d.Options["order"] != "asc":
+				return nil, fmt.Errorf("invalid index order '%s' on field '%s'", d.Options["order"], field.Name)
+			}
+
+			if _, ok := fields[d.Value]; !ok {
+				names = append(names, d.Value)
+			}
+			fields[d.Value] = append(fields[d.Value], f)
+		}
+	}
+
+	var indexes []Index
+	for _, name := range names {
+		ix, err := modelIndex(collectionName, false, fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("index '%s': %w", name, err)
+		}
+		indexes = append(indexes, ix)
+	}
+	return indexes, nil
+}
+
+// Indexes returns the composite indexes declared by the models of the default DB.
+func Indexes() []Index {
+	return defaultDB.Indexes()
+}
+
+// Indexes returns the composite indexes declared by the registered models,
+// without duplicates.
+func (db *DB) Indexes() []Index {
+	models := db.registry()
+	var indexes []Index
+	for _, name := range models.names() {
+		if info, ok := models.get(name); ok {
+			indexes = append(indexes, info.Indexes...)
+		}
+	}
+	return dedupIndexes(indexes)
+}
+
+func dedupIndexes(indexes []Index) []Index {
+	seen := make(map[string]bool)
+	var unique []Index
+	for _, ix := range indexes {
+		if key := ix.String(); !seen[key] {
+			seen[key] = true
+			unique = append(unique, ix)
+		}
+	}
+	return unique
+}
+
+// GenerateIndexes returns the firestore.indexes.json of the default DB.
+func GenerateIndexes(extra ...Index) ([]byte, error) {
+	return defaultDB.GenerateIndexes(extra...)
+}
+
+// GenerateIndexes returns a firestore.indexes.json file, as deployed with
+// `firebase deploy --only firestore:indexes`, holding the indexes declared by
+// the registered models and any extra ones, such as the suggestions of an
+// IndexRecorder.
+func (db *DB) GenerateIndexes(extra ...Index) ([]byte, error) {
+	type fieldJSON struct {
+		FieldPath   string `json:"fieldPath"`
+		Order       string `json:"order,omitempty"`
+		ArrayConfig string `json:"arrayConfig,omitempty"`
+	}
+	type indexJSON struct {
+		CollectionGroup string      `json:"collectionGroup"`
+		QueryScope      string      `json:"queryScope"`
+		Fields          []fieldJSON `json:"fields"`
+	}
+	file := struct {
+		Indexes        []indexJSON   `json:"indexes"`
+		FieldOverrides []interface{} `json:"fieldOverrides"`
+	}{Indexes: []indexJSON{}, FieldOverrides: []interface{}{}}
+
+	for _, ix := range dedupIndexes(append(db.Indexes(), extra...)) {
+		out := indexJSON{CollectionGroup: ix.Collection, QueryScope: "COLLECTION"}
+		if ix.Group {
+			out.QueryScope = "COLLECTION_GROUP"
+		}
+		for _, f := range ix.Fields {
+			field := fieldJSON{FieldPath: f.Field}
+			switch {
+			case f.ArrayContains:
+				field.ArrayConfig = "CONTAINS"
+			case f.Direction == firestore.Desc:
+				field.Order = "DESCENDING"
+			default:
+				field.Order = "ASCENDING"
+			}
+			out.Fields = append(out.Fields, field)
+		}
+		file.Indexes = append(file.Indexes, out)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// sortIndexFields orders index fields by name, for equality fields whose
+// order within an index does not matter.
+func sortIndexFields(fields []IndexField) {
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+}
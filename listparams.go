@@ -0,0 +1,261 @@
+package firegorm
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ListParams is a list request parsed from a query string by ParseListParams.
+// Field names are translated to their Firestore names.
+type ListParams struct {
+	Filters        map[string]interface{}
+	Sort           []SortField
+	Limit          int
+	StartAfter     string
+	Fields         []string               // Fields to select; all when empty
+	Where          firestore.EntityFilter // Parsed filter expression, if any
+	IncludeDeleted bool
+}
+
+// Options returns the query options carrying the sort, field selection,
+// filter expression and include-deleted flag, for List:
+//
+//	model.List(ctx, p.Filters, p.Limit, p.StartAfter, "", "", &results, p.Options()...)
+func (p ListParams) Options() []QueryOption {
+	var opts []QueryOption
+	if len(p.Sort) > 0 {
+		specs := make([]string, len(p.Sort))
+		for i, clause := range p.Sort {
+			specs[i] = clause.String()
+		}
+		opts = append(opts, SortBy(specs...))
+	}
+	if len(p.Fields) > 0 {
+		opts = append(opts, Select(p.Fields...))
+	}
+	if p.Where != nil {
+		opts = append(opts, WhereFilter(p.Where))
+	}
+	if p.IncludeDeleted {
+		opts = append(opts, IncludeDeleted())
+	}
+	return opts
+}
+
+// ListParamsOption configures ParseListParams.
+type ListParamsOption func(*listParamsConfig)
+
+type listParamsConfig struct {
+	defaultLimit int
+	maxLimit     int
+	ignore       map[string]bool
+}
+
+// ListDefaultLimit sets the limit used when the query string has none (20 by default).
+func ListDefaultLimit(n int) ListParamsOption {
+	return func(c *listParamsConfig) {
+		c.defaultLimit = n
+	}
+}
+
+// ListMaxLimit caps the limit parameter (100 by default). Larger values are
+// lowered to it rather than rejected.
+func ListMaxLimit(n int) ListParamsOption {
+	return func(c *listParamsConfig) {
+		c.maxLimit = n
+	}
+}
+
+// ListIgnore skips query parameters the application handles itself, which
+// would otherwise be rejected as unknown filters.
+func ListIgnore(params ...string) ListParamsOption {
+	return func(c *listParamsConfig) {
+		for _, param := range params {
+			c.ignore[param] = true
+		}
+	}
+}
+
+// filterOperators are the operator suffixes accepted by parseFilter.
+var filterOperators = map[string]bool{"gt": true, "gte": true, "lt": true, "lte": true}
+
+// ParseListParams parses the query string of a list endpoint for a
+// registered model. It understands:
+//
+//	limit=20                  page size, capped by ListMaxLimit
+//	start_after=<id>          page token returned by List (cursor is an alias)
+//	sort=-priority,title      sort specification; order=asc|desc for a single field
+//	fields=title,status       fields to select
+//	filter=<expression>       filter expression, see ParseFilterExpr
+//	include_deleted=true      also return soft-deleted documents
+//
+// Every other parameter is a filter in the notation of ExtractFilters, such
+// as status=open, tags=a,b or created_at__gte=2024-01-01. Fields may be given
+// by their Firestore or JSON name. Invalid input is reported as a
+// *ValidationError whose Field is the offending parameter and whose message
+// can be returned to API clients as is.
+func ParseListParams(values url.Values, model interface{}, opts ...ListParamsOption) (ListParams, error) {
+	handle, ok := model.(interface{ GetModelInfo() (ModelInfo, error) })
+	if !ok {
+		return ListParams{}, fmt.Errorf("cannot parse list parameters for %T: expected a model registered with RegisterModel", model)
+	}
+	info, err := handle.GetModelInfo()
+	if err != nil {
+		return ListParams{}, err
+	}
+
+	config := listParamsConfig{defaultLimit: 20, maxLimit: 100, ignore: make(map[string]bool)}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	params := ListParams{Filters: make(map[string]interface{}), Limit: config.defaultLimit}
+
+	if raw := values.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return ListParams{}, invalid("limit", "invalid limit %q: must be a positive integer", raw)
+		}
+		params.Limit = n
+	}
+	if config.maxLimit > 0 && params.Limit > config.maxLimit {
+		params.Limit = config.maxLimit
+	}
+
+	params.StartAfter = values.Get("start_after")
+	if cursor := values.Get("cursor"); cursor != "" {
+		if params.StartAfter != "" && params.StartAfter != cursor {
+			return ListParams{}, invalid("cursor", "cursor and start_after cannot both be set")
+		}
+		params.StartAfter = cursor
+	}
+
+	if params.Sort, err = parseSortParams(values.Get("sort"), values.Get("order"), info); err != nil {
+		return ListParams{}, err
+	}
+
+	if raw := values.Get("fields"); raw != "" {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+			stored, ok := info.storedName(name)
+			if !ok {
+				return ListParams{}, invalid("fields", "cannot select '%s': unknown field", name)
+			}
+			params.Fields = append(params.Fields, stored)
+		}
+	}
+
+	if raw := values.Get("filter"); raw != "" {
+		filter, err := ParseFilterExpr(raw)
+		if err != nil {
+			return ListParams{}, invalid("filter", "%v", err)
+		}
+		params.Where, err = mapFilterFields(filter, func(name string) (string, error) {
+			stored, ok := info.storedName(name)
+			if !ok {
+				return "", invalid("filter", "cannot filter by '%s': unknown field", name)
+			}
+			return stored, nil
+		})
+		if err != nil {
+			return ListParams{}, err
+		}
+	}
+
+	if raw := values.Get("include_deleted"); raw != "" {
+		if params.IncludeDeleted, err = strconv.ParseBool(raw); err != nil {
+			return ListParams{}, invalid("include_deleted", "invalid include_deleted %q: must be true or false", raw)
+		}
+	}
+
+	// Filters, in a stable order so the first error is always the same.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case "limit", "start_after", "cursor", "sort", "order", "fields", "filter", "include_deleted":
+			continue
+		}
+		if config.ignore[key] {
+			continue
+		}
+
+		name, op, hasOp := strings.Cut(key, "__")
+		if hasOp && !filterOperators[op] {
+			return ListParams{}, invalid(key, "invalid filter '%s': unknown operator '%s', use gt, gte, lt or lte", key, op)
+		}
+		stored, ok := info.storedName(name)
+		if !ok {
+			return ListParams{}, invalid(key, "cannot filter by '%s': unknown field", name)
+		}
+		if hasOp {
+			stored += "__" + op
+		}
+
+		filter := ExtractFilters(map[string]string{stored: strings.Join(values[key], ",")}, nil)
+		if _, _, _, err := parseFilter(stored, filter[stored]); err != nil {
+			return ListParams{}, invalid(key, "invalid value for filter '%s': %q", key, values.Get(key))
+		}
+		params.Filters[stored] = filter[stored]
+	}
+	return params, nil
+}
+
+// parseSortParams parses the sort and order parameters. order only applies
+// to a single field without a direction prefix.
+func parseSortParams(spec, order string, info ModelInfo) ([]SortField, error) {
+	clauses, err := ParseSort(spec)
+	if err != nil {
+		return nil, &ValidationError{Field: "sort", Message: err.Error()}
+	}
+	switch order {
+	case "":
+	case "asc", "desc":
+		if len(clauses) != 1 || strings.HasPrefix(strings.TrimSpace(spec), "-") {
+			return nil, invalid("order", "order only applies to a single sort field without a '-' prefix")
+		}
+		clauses[0].Direction = firestore.Asc
+		if order == "desc" {
+			clauses[0].Direction = firestore.Desc
+		}
+	default:
+		return nil, invalid("order", "invalid order %q: must be asc or desc", order)
+	}
+
+	for i, clause := range clauses {
+		stored, ok := info.storedName(clause.Field)
+		if !ok {
+			return nil, invalid("sort", "cannot sort by '%s': unknown field", clause.Field)
+		}
+		clauses[i].Field = stored
+	}
+	return clauses, nil
+}
+
+// storedName returns the Firestore name of a field given by its Firestore
+// or JSON name.
+func (info ModelInfo) storedName(name string) (string, bool) {
+	if baseFieldNames[name] {
+		return name, true
+	}
+	fieldName, ok := info.TagToFieldMap[name]
+	if !ok || info.Schema == nil {
+		return "", false
+	}
+	field, ok := info.Schema.FieldByName(fieldName)
+	if !ok {
+		return "", false
+	}
+	if stored := tagName(field.Tag.Get("firestore")); stored != "" {
+		return stored, true
+	}
+	return field.Name, true
+}
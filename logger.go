@@ -1,9 +1,12 @@
 package firegorm
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"sync"
 )
 
 // LogLevel represents the severity level of the logger.
@@ -16,36 +19,141 @@ const (
 	ERROR
 )
 
-// logger is the global logger instance.
-var logger *log.Logger
-var logLevel LogLevel
+// String returns the level name as accepted by SetLogLevel.
+func (l LogLevel) String() string {
+	switch l {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// Attr is a structured key/value pair attached to a log entry.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives every log entry written by Firegorm. Implement it to send
+// the logs to zap, zerolog or any other logging library; entries below the
+// level configured with SetLogLevel are filtered out before reaching it.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, attrs ...Attr)
+}
+
+// logState holds the global logger and level. They are usable without
+// calling InitializeLogger or Init, and may be replaced while models log.
+var logState = struct {
+	sync.RWMutex
+	logger Logger
+	level  LogLevel
+}{logger: newDefaultLogger(), level: INFO}
 
 // SetLogLevel configures the logging level for Firegorm.
 func SetLogLevel(level string) {
-	level = strings.ToUpper(level)
-	switch level {
+	parsed := INFO // Default level
+	switch strings.ToUpper(level) {
 	case "DEBUG":
-		logLevel = DEBUG
-	case "INFO":
-		logLevel = INFO
+		parsed = DEBUG
 	case "WARN":
-		logLevel = WARN
+		parsed = WARN
 	case "ERROR":
-		logLevel = ERROR
-	default:
-		logLevel = INFO // Default level
+		parsed = ERROR
+	}
+	logState.Lock()
+	logState.level = parsed
+	logState.Unlock()
+}
+
+// SetLogger replaces the logger Firegorm writes to. Passing nil restores the default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = newDefaultLogger()
 	}
+	logState.Lock()
+	logState.logger = l
+	logState.Unlock()
 }
 
 // Log logs messages based on the current logging level.
 func Log(level LogLevel, format string, v ...interface{}) {
-	if level >= logLevel {
-		logger.Printf(format, v...)
-	}
+	logf(context.Background(), level, format, v...)
+}
+
+// logf is Log for code running on behalf of a caller, whose ctx reaches the
+// logger along with the request ID it carries.
+func logf(ctx context.Context, level LogLevel, format string, v ...interface{}) {
+	defaultDB.logf(ctx, level, format, v...)
 }
 
 // InitializeLogger sets up the logger.
 func InitializeLogger() {
-	logger = log.New(os.Stdout, "[Firegorm] ", log.LstdFlags)
+	SetLogger(nil)
 	SetLogLevel(os.Getenv("FIREGORM_LOG_LEVEL"))
 }
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying a request ID that is attached to
+// every structured log entry written for operations using that context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set with WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// slogLogger adapts a *slog.Logger to the Logger interface.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger returns a Logger that writes to l, or to slog.Default() if l is nil.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Log(ctx context.Context, level LogLevel, msg string, attrs ...Attr) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	slogAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		slogAttrs[i] = slog.Any(a.Key, a.Value)
+	}
+	s.l.LogAttrs(ctx, slogLevel(level), msg, slogAttrs...)
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// newDefaultLogger writes text entries to stdout. Filtering is done by
+// SetLogLevel, so the handler itself accepts every level.
+func newDefaultLogger() Logger {
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return NewSlogLogger(slog.New(handler).With("logger", "firegorm"))
+}
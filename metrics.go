@@ -0,0 +1,102 @@
+package firegorm
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics receives measurements for every ORM operation, labeled by
+// collection and operation name (Create, Get, List, ...). Implementations
+// must be safe for concurrent use.
+type Metrics interface {
+	// ObserveOperation records how long an operation took and whether it failed.
+	ObserveOperation(collection, operation string, duration time.Duration, err error)
+	// AddReads records document reads billed by Firestore for an operation.
+	AddReads(collection, operation string, n int)
+	// AddWrites records document writes issued by an operation.
+	AddWrites(collection, operation string, n int)
+}
+
+// noopMetrics discards every measurement.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOperation(string, string, time.Duration, error) {}
+func (noopMetrics) AddReads(string, string, int)                          {}
+func (noopMetrics) AddWrites(string, string, int)                         {}
+
+// metrics is the global metrics sink. Metrics are off until SetMetrics is called.
+var metrics = guarded[Metrics]{v: noopMetrics{}}
+
+// SetMetrics sends operation metrics to m. Passing nil turns metrics off again.
+// See NewOTelMetrics and the prommetrics package for ready-made adapters.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = noopMetrics{}
+	}
+	metrics.store(m)
+}
+
+// otelMetrics records operation metrics with OpenTelemetry instruments.
+type otelMetrics struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+	reads    metric.Int64Counter
+	writes   metric.Int64Counter
+}
+
+// NewOTelMetrics returns a Metrics adapter that records to meters created by mp:
+// firegorm.operation.duration (seconds), firegorm.operation.errors,
+// firegorm.document.reads and firegorm.document.writes, each with
+// "collection" and "operation" attributes.
+func NewOTelMetrics(mp metric.MeterProvider) (Metrics, error) {
+	meter := mp.Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram("firegorm.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of Firegorm operations."))
+	if err != nil {
+		return nil, err
+	}
+	errors, err := meter.Int64Counter("firegorm.operation.errors",
+		metric.WithDescription("Number of Firegorm operations that returned an error."))
+	if err != nil {
+		return nil, err
+	}
+	reads, err := meter.Int64Counter("firegorm.document.reads",
+		metric.WithDescription("Number of Firestore document reads."))
+	if err != nil {
+		return nil, err
+	}
+	writes, err := meter.Int64Counter("firegorm.document.writes",
+		metric.WithDescription("Number of Firestore document writes."))
+	if err != nil {
+		return nil, err
+	}
+
+	return &otelMetrics{duration: duration, errors: errors, reads: reads, writes: writes}, nil
+}
+
+func metricAttributes(collection, operation string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("collection", collection),
+		attribute.String("operation", operation),
+	)
+}
+
+func (m *otelMetrics) ObserveOperation(collection, operation string, duration time.Duration, err error) {
+	attrs := metricAttributes(collection, operation)
+	m.duration.Record(context.Background(), duration.Seconds(), attrs)
+	if err != nil {
+		m.errors.Add(context.Background(), 1, attrs)
+	}
+}
+
+func (m *otelMetrics) AddReads(collection, operation string, n int) {
+	m.reads.Add(context.Background(), int64(n), metricAttributes(collection, operation))
+}
+
+func (m *otelMetrics) AddWrites(collection, operation string, n int) {
+	m.writes.Add(context.Background(), int64(n), metricAttributes(collection, operation))
+}
@@ -0,0 +1,493 @@
+// Package migrations applies versioned, resumable schema migrations to
+// Firestore collections.
+//
+// Migrations are registered in Go and applied in the order of their IDs. Each
+// one walks a collection in batches and turns every document into a list of
+// updates. The updates of a batch are committed together with a checkpoint in
+// the _firegorm_migrations collection, so an interrupted run resumes where it
+// stopped:
+//
+//	m := migrations.New(firegorm.Client)
+//	m.Register(migrations.Migration{
+//		ID:         "0001_rename_title",
+//		Collection: "tasks",
+//		Up:         migrations.RenameField("title", "name"),
+//		Down:       migrations.RenameField("name", "title"),
+//	})
+//	if err := m.Up(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// Call Up at startup, or expose the migrator through RunCommand.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GEMSDEV-mx/firegorm"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultStateCollection stores the state of every migration.
+	DefaultStateCollection = "_firegorm_migrations"
+	// DefaultBatchSize is the number of documents migrated per commit.
+	DefaultBatchSize = 200
+	// maxBatchSize keeps a batch, its checkpoint and the lock refresh within
+	// the 500 writes allowed in a Firestore transaction.
+	maxBatchSize = 400
+
+	lockID    = "_lock"
+	lockLease = 5 * time.Minute
+)
+
+// Status values of a migration.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running" // Being applied; resumes from its checkpoint
+	StatusApplied   = "applied"
+	StatusReverting = "reverting" // Being rolled back; resumes from its checkpoint
+)
+
+// ErrLocked is returned when another process is running migrations.
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// DocFunc migrates a single document. It returns the updates to apply, or no
+// updates to leave the document unchanged. Use firestore.Delete as a value to
+// remove a field.
+type DocFunc func(ctx context.Context, doc *firestore.DocumentSnapshot) ([]firestore.Update, error)
+
+// Migration is a versioned change to the documents of a collection.
+type Migration struct {
+	ID          string // Unique ID; migrations run in lexical order, e.g. "0001_rename_title"
+	Description string
+	Collection  string  // Collection path walked by Up and Down
+	Up          DocFunc // Applies the change to one document
+	Down        DocFunc // Reverts the change; nil if the migration cannot be reverted
+}
+
+// State is the progress of a migration, stored in the state collection under
+// the migration ID.
+type State struct {
+	ID          string     `firestore:"id"`
+	Description string     `firestore:"description"`
+	Status      string     `firestore:"status"`
+	Checkpoint  string     `firestore:"checkpoint"` // ID of the last migrated document
+	Processed   int        `firestore:"processed"`
+	StartedAt   time.Time  `firestore:"started_at"`
+	AppliedAt   *time.Time `firestore:"applied_at"`
+}
+
+// Migrator applies registered migrations.
+type Migrator struct {
+	client     *firestore.Client
+	collection string
+	batchSize  int
+	owner      string // Identifies this migrator in the lock document
+	migrations []Migration
+}
+
+// Option configures a Migrator.
+type Option func(*Migrator)
+
+// WithBatchSize sets how many documents are migrated per commit, up to 400.
+func WithBatchSize(n int) Option {
+	return func(m *Migrator) {
+		if n > 0 && n <= maxBatchSize {
+			m.batchSize = n
+		}
+	}
+}
+
+// WithStateCollection stores migration state in another collection.
+func WithStateCollection(name string) Option {
+	return func(m *Migrator) {
+		if name != "" {
+			m.collection = name
+		}
+	}
+}
+
+// New creates a Migrator that works with client, or with firegorm.Client if
+// client is nil.
+func New(client *firestore.Client, opts ...Option) *Migrator {
+	if client == nil {
+		client = firegorm.Client
+	}
+	m := &Migrator{
+		client:     client,
+		collection: DefaultStateCollection,
+		batchSize:  DefaultBatchSize,
+		owner:      uuid.NewString(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Register adds migrations. IDs must be unique.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, mig := range migrations {
+		switch {
+		case mig.ID == "" || mig.ID == lockID:
+			return fmt.Errorf("invalid migration ID '%s'", mig.ID)
+		case mig.Collection == "":
+			return fmt.Errorf("migration '%s' has no collection", mig.ID)
+		case mig.Up == nil:
+			return fmt.Errorf("migration '%s' has no Up function", mig.ID)
+		}
+		for _, existing := range m.migrations {
+			if existing.ID == mig.ID {
+				return fmt.Errorf("migration '%s' is already registered", mig.ID)
+			}
+		}
+		m.migrations = append(m.migrations, mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].ID < m.migrations[j].ID })
+	return nil
+}
+
+// Up applies every pending migration in order, resuming one that was
+// interrupted.
+func (m *Migrator) Up(ctx context.Context) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	states, err := m.states(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mig := range m.migrations {
+		state := states[mig.ID]
+		switch state.Status {
+		case StatusApplied:
+			continue
+		case StatusReverting:
+			return fmt.Errorf("migration '%s' is being reverted; run Down to finish it first", mig.ID)
+		}
+		if err := m.run(ctx, mig, state, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down reverts the last steps applied migrations, newest first, resuming one
+// whose revert was interrupted.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+
+	states, err := m.states(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		mig := m.migrations[i]
+		state := states[mig.ID]
+		switch state.Status {
+		case StatusPending:
+			continue
+		case StatusRunning:
+			return fmt.Errorf("migration '%s' is partially applied; run Up to finish it first", mig.ID)
+		}
+		if mig.Down == nil {
+			return fmt.Errorf("migration '%s' cannot be reverted: it has no Down function", mig.ID)
+		}
+		if err := m.run(ctx, mig, state, false); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// Status returns the state of every registered migration, in order.
+// Migrations that never ran have StatusPending.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	states, err := m.states(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]State, len(m.migrations))
+	for i, mig := range m.migrations {
+		result[i] = states[mig.ID]
+	}
+	return result, nil
+}
+
+// states loads the stored state of every registered migration.
+func (m *Migrator) states(ctx context.Context) (map[string]State, error) {
+	if m.client == nil {
+		return nil, errors.New("firestore client is not initialized")
+	}
+	docs, err := m.client.Collection(m.collection).Documents(ctx).GetAll()
+	if err != nil {
+		firegorm.Log(firegorm.ERROR, "Failed to load migration state from '%s': %v", m.collection, err)
+		return nil, err
+	}
+
+	stored := make(map[string]State, len(docs))
+	for _, doc := range docs {
+		if doc.Ref.ID == lockID {
+			continue
+		}
+		var state State
+		if err := doc.DataTo(&state); err != nil {
+			return nil, fmt.Errorf("invalid state for migration '%s': %w", doc.Ref.ID, err)
+		}
+		stored[doc.Ref.ID] = state
+	}
+
+	states := make(map[string]State, len(m.migrations))
+	for _, mig := range m.migrations {
+		state, ok := stored[mig.ID]
+		if !ok {
+			state = State{ID: mig.ID, Description: mig.Description, Status: StatusPending}
+		}
+		states[mig.ID] = state
+	}
+	return states, nil
+}
+
+// run walks the migration's collection in batches, applying Up or Down.
+func (m *Migrator) run(ctx context.Context, mig Migration, state State, up bool) error {
+	fn, status, action := mig.Up, StatusRunning, "Applying"
+	if !up {
+		fn, status, action = mig.Down, StatusReverting, "Reverting"
+	}
+
+	if state.Status != status {
+		state = State{ID: mig.ID, Description: mig.Description, Status: status, StartedAt: time.Now().UTC()}
+		if _, err := m.stateRef(mig.ID).Set(ctx, state); err != nil {
+			return err
+		}
+		firegorm.Log(firegorm.INFO, "%s migration '%s' on collection '%s'", action, mig.ID, mig.Collection)
+	} else {
+		firegorm.Log(firegorm.INFO, "Resuming migration '%s' after document '%s' (%d processed)", mig.ID, state.Checkpoint, state.Processed)
+	}
+
+	col := m.client.Collection(mig.Collection)
+	for {
+		query := col.OrderBy(firestore.DocumentID, firestore.Asc).Limit(m.batchSize)
+		if state.Checkpoint != "" {
+			query = query.StartAfter(state.Checkpoint)
+		}
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			firegorm.Log(firegorm.ERROR, "Migration '%s' failed to read collection '%s': %v", mig.ID, mig.Collection, err)
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		writes := make(map[*firestore.DocumentRef][]firestore.Update)
+		for _, doc := range docs {
+			updates, err := fn(ctx, doc)
+			if err != nil {
+				err = fmt.Errorf("migration '%s' failed on document '%s': %w", mig.ID, doc.Ref.ID, err)
+				firegorm.Log(firegorm.ERROR, "%v", err)
+				return err
+			}
+			if len(updates) > 0 {
+				writes[doc.Ref] = updates
+			}
+		}
+
+		state.Checkpoint = docs[len(docs)-1].Ref.ID
+		state.Processed += len(docs)
+		if err := m.commit(ctx, writes, state); err != nil {
+			firegorm.Log(firegorm.ERROR, "Migration '%s' failed to commit batch: %v", mig.ID, err)
+			return err
+		}
+		firegorm.Log(firegorm.DEBUG, "Migration '%s' checkpoint at document '%s' (%d processed)", mig.ID, state.Checkpoint, state.Processed)
+
+		if len(docs) < m.batchSize {
+			break
+		}
+	}
+
+	if !up {
+		if _, err := m.stateRef(mig.ID).Delete(ctx); err != nil {
+			return err
+		}
+		firegorm.Log(firegorm.INFO, "Reverted migration '%s' (%d documents)", mig.ID, state.Processed)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	state.Status, state.Checkpoint, state.AppliedAt = StatusApplied, "", &now
+	if _, err := m.stateRef(mig.ID).Set(ctx, state); err != nil {
+		return err
+	}
+	firegorm.Log(firegorm.INFO, "Applied migration '%s' (%d documents)", mig.ID, state.Processed)
+	return nil
+}
+
+// commit writes the updates of a batch together with its checkpoint, and
+// extends the lock. It fails with ErrLocked, writing nothing, if the lease of
+// this migrator ran out, as another process may have taken the lock since.
+func (m *Migrator) commit(ctx context.Context, writes map[*firestore.DocumentRef][]firestore.Update, state State) error {
+	lock := m.stateRef(lockID)
+	return m.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(lock)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		var owner string
+		var expires time.Time
+		if err == nil {
+			owner, _ = snap.Data()["owner"].(string)
+			expires, _ = snap.Data()["expires_at"].(time.Time)
+		}
+		if owner != m.owner || !time.Now().Before(expires) {
+			return fmt.Errorf("%w: the lease of this migrator has expired", ErrLocked)
+		}
+
+		for ref, updates := range writes {
+			if err := tx.Update(ref, updates); err != nil {
+				return err
+			}
+		}
+		if err := tx.Set(m.stateRef(state.ID), state); err != nil {
+			return err
+		}
+		return tx.Set(m.stateRef(lockID), m.lockData())
+	})
+}
+
+func (m *Migrator) stateRef(id string) *firestore.DocumentRef {
+	return m.client.Collection(m.collection).Doc(id)
+}
+
+func (m *Migrator) lockData() map[string]interface{} {
+	return map[string]interface{}{
+		"owner":      m.owner,
+		"expires_at": time.Now().Add(lockLease).UTC(),
+	}
+}
+
+// lock takes the migration lock, so that only one process migrates at a time.
+// A lock left behind by a crashed process expires after its lease.
+func (m *Migrator) lock(ctx context.Context) error {
+	if m.client == nil {
+		return errors.New("firestore client is not initialized")
+	}
+	ref := m.stateRef(lockID)
+	return m.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			owner, _ := snap.Data()["owner"].(string)
+			expires, _ := snap.Data()["expires_at"].(time.Time)
+			if owner != m.owner && time.Now().Before(expires) {
+				return fmt.Errorf("%w until %s", ErrLocked, expires.Format(time.RFC3339))
+			}
+		}
+		return tx.Set(ref, m.lockData())
+	})
+}
+
+// unlock releases the migration lock, unless its lease ran out and another
+// process has taken it since.
+func (m *Migrator) unlock() {
+	ref := m.stateRef(lockID)
+	err := m.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if owner, _ := snap.Data()["owner"].(string); owner != m.owner {
+			firegorm.Log(firegorm.WARN, "Migration lock is held by another process; leaving it in place")
+			return nil
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		firegorm.Log(firegorm.WARN, "Failed to release migration lock: %v", err)
+	}
+}
+
+// RunCommand runs a migration command given as command-line arguments and
+// writes its output to w, so an application can expose its migrations in its
+// own binary:
+//
+//	up           apply every pending migration
+//	down [n]     revert the last n applied migrations (default 1)
+//	status       list every migration with its status
+func (m *Migrator) RunCommand(ctx context.Context, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: up | down [n] | status")
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return errors.New("usage: up")
+		}
+		return m.Up(ctx)
+
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errors.New("usage: down [n]")
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations '%s'", args[1])
+			}
+			steps = n
+		}
+		return m.Down(ctx, steps)
+
+	case "status":
+		states, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tPROCESSED\tDESCRIPTION")
+		for _, s := range states {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", s.ID, s.Status, s.Processed, s.Description)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown migration command '%s'; usage: up | down [n] | status", args[0])
+}
+
+// RenameField returns a DocFunc that moves the value of the top-level field
+// from to the field to. Documents without the field are left unchanged.
+func RenameField(from, to string) DocFunc {
+	return func(ctx context.Context, doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+		value, ok := doc.Data()[from]
+		if !ok {
+			return nil, nil
+		}
+		return []firestore.Update{
+			{Path: to, Value: value},
+			{Path: from, Value: firestore.Delete},
+		}, nil
+	}
+}
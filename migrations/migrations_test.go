@@ -0,0 +1,215 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/GEMSDEV-mx/firegorm"
+	"github.com/google/uuid"
+)
+
+func noop(ctx context.Context, doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	return nil, nil
+}
+
+func TestRegister(t *testing.T) {
+	m := New(nil)
+	err := m.Register(
+		Migration{ID: "0002_second", Collection: "tasks", Up: noop},
+		Migration{ID: "0001_first", Collection: "tasks", Up: noop},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.migrations[0].ID != "0001_first" || m.migrations[1].ID != "0002_second" {
+		t.Errorf("expected migrations sorted by ID, got %s, %s", m.migrations[0].ID, m.migrations[1].ID)
+	}
+
+	for _, invalid := range []Migration{
+		{ID: "0001_first", Collection: "tasks", Up: noop},
+		{ID: "", Collection: "tasks", Up: noop},
+		{ID: lockID, Collection: "tasks", Up: noop},
+		{ID: "0003", Up: noop},
+		{ID: "0004", Collection: "tasks"},
+	} {
+		if err := m.Register(invalid); err == nil {
+			t.Errorf("expected error registering %+v, got nil", invalid)
+		}
+	}
+}
+
+func TestRunCommand_Usage(t *testing.T) {
+	m := New(nil)
+	for _, args := range [][]string{nil, {"sideways"}, {"up", "now"}, {"down", "zero"}, {"down", "0"}, {"down", "1", "2"}} {
+		if err := m.RunCommand(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("expected error for args %v, got nil", args)
+		}
+	}
+}
+
+// TestMigrator_Emulator runs migrations against the Firestore emulator.
+func TestMigrator_Emulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db, err := firegorm.Open(firegorm.Config{ProjectID: "demo-" + uuid.NewString()[:8]})
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+	client := db.Client()
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := client.Collection("tasks").Doc(id).Set(ctx, map[string]interface{}{"title": id}); err != nil {
+			t.Fatalf("failed to seed document: %v", err)
+		}
+	}
+
+	// The first run fails on document "d", after the batch holding "a" and "b"
+	// was committed.
+	failOn := "d"
+	calls := make(map[string]int)
+	rename := RenameField("title", "name")
+	m := New(client, WithBatchSize(2))
+	err = m.Register(Migration{
+		ID:         "0001_rename_title",
+		Collection: "tasks",
+		Up: func(ctx context.Context, doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+			if doc.Ref.ID == failOn {
+				return nil, errors.New("boom")
+			}
+			calls[doc.Ref.ID]++
+			return rename(ctx, doc)
+		},
+		Down: RenameField("name", "title"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	states, err := m.Status(ctx)
+	if err != nil || states[0].Status != StatusRunning || states[0].Checkpoint != "b" {
+		t.Fatalf("expected a checkpoint at 'b', got %+v, %v", states, err)
+	}
+
+	failOn = ""
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected error resuming: %v", err)
+	}
+	if calls["a"] != 1 || calls["b"] != 1 || calls["e"] != 1 {
+		t.Errorf("expected every document to be migrated once, got %v", calls)
+	}
+	snap, err := client.Collection("tasks").Doc("e").Get(ctx)
+	if err != nil || snap.Data()["name"] != "e" || snap.Data()["title"] != nil {
+		t.Errorf("unexpected migrated document: %v, %v", snap.Data(), err)
+	}
+
+	var out bytes.Buffer
+	if err := m.RunCommand(ctx, []string{"status"}, &out); err != nil || !strings.Contains(out.String(), StatusApplied) {
+		t.Errorf("unexpected status output %q, %v", out.String(), err)
+	}
+
+	if err := m.RunCommand(ctx, []string{"down"}, &out); err != nil {
+		t.Fatalf("unexpected error reverting: %v", err)
+	}
+	snap, err = client.Collection("tasks").Doc("a").Get(ctx)
+	if err != nil || snap.Data()["title"] != "a" {
+		t.Errorf("expected the field to be renamed back, got %v, %v", snap.Data(), err)
+	}
+	if states, _ := m.Status(ctx); states[0].Status != StatusPending {
+		t.Errorf("expected the migration to be pending again, got %s", states[0].Status)
+	}
+}
+
+func TestUnlock_KeepsOtherOwnersLockEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db, err := firegorm.Open(firegorm.Config{ProjectID: "demo-" + uuid.NewString()[:8]})
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	first, second := New(db.Client()), New(db.Client())
+	if err := first.lock(ctx); err != nil {
+		t.Fatalf("unexpected error locking: %v", err)
+	}
+	if err := second.lock(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	// A process whose lease ran out must not release the lock of the next one.
+	second.unlock()
+	if err := second.lock(ctx); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected the lock to be kept, got %v", err)
+	}
+
+	first.unlock()
+	if err := second.lock(ctx); err != nil {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+}
+
+func TestCommit_StopsAfterLockIsTakenEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db, err := firegorm.Open(firegorm.Config{ProjectID: "demo-" + uuid.NewString()[:8]})
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	defer db.Close()
+	client := db.Client()
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if _, err := client.Collection("tasks").Doc(id).Set(ctx, map[string]interface{}{"title": id}); err != nil {
+			t.Fatalf("failed to seed document: %v", err)
+		}
+	}
+
+	m := New(client, WithBatchSize(2))
+	rename := RenameField("title", "name")
+	err = m.Register(Migration{
+		ID:         "0001_rename_title",
+		Collection: "tasks",
+		Up: func(ctx context.Context, doc *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+			if doc.Ref.ID == "c" {
+				// Between the batches, the lease runs out and another process takes the lock.
+				other := map[string]interface{}{"owner": "other", "expires_at": time.Now().Add(time.Minute).UTC()}
+				if _, err := m.stateRef(lockID).Set(ctx, other); err != nil {
+					return nil, err
+				}
+			}
+			return rename(ctx, doc)
+		},
+		Down: RenameField("name", "title"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := m.Up(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	snap, err := client.Collection("tasks").Doc("c").Get(ctx)
+	if err != nil || snap.Data()["title"] != "c" {
+		t.Errorf("expected the second batch not to be written, got %v, %v", snap.Data(), err)
+	}
+	lock, err := m.stateRef(lockID).Get(ctx)
+	if err != nil || lock.Data()["owner"] != "other" {
+		t.Errorf("expected the other process to keep the lock, got %v, %v", lock.Data(), err)
+	}
+}
@@ -14,38 +14,52 @@ type BaseModel struct {
 	DeletedAt     *time.Time `firestore:"deleted_at" json:"deleted_at"`
 	CollectionName string     `firestore:"-" json:"-"` // Not persisted in Firestore
 	ModelName      string     `firestore:"-" json:"-"` // Not persisted in Firestore
+
+	parentIDs []string // Parent document IDs bound with In
+	group     bool     // Set on collection group handles returned by Group
+	db        *DB      // DB the model was registered with; nil for the default DB
 }
 
 // SetCollectionName explicitly sets the collection name.
 func (b *BaseModel) SetCollectionName(name string) {
 	b.CollectionName = name
-	Log(DEBUG, "Set collection name to '%s'", name)
+	b.log(DEBUG, "Set collection name to '%s'", name)
 }
 
 // SetModelName explicitly sets the model name.
 func (b *BaseModel) SetModelName(name string) {
 	b.ModelName = name
-	Log(DEBUG, "Set model name to '%s'", name)
+	b.log(DEBUG, "Set model name to '%s'", name)
 }
 
 // GetCollectionName returns the collection name.
 func (b *BaseModel) GetCollectionName() string {
-	Log(DEBUG, "Getting collection name: '%s'", b.CollectionName)
+	b.log(DEBUG, "Getting collection name: '%s'", b.CollectionName)
 	return b.CollectionName
 }
 
 // GetModelName returns the model name.
 func (b *BaseModel) GetModelName() string {
-	Log(DEBUG, "Getting model name: '%s'", b.ModelName)
+	b.log(DEBUG, "Getting model name: '%s'", b.ModelName)
 	return b.ModelName
 }
 
 // EnsureCollection ensures that the collection name is set.
 func (b *BaseModel) EnsureCollection() error {
 	if b.CollectionName == "" {
-		Log(WARN, "Collection name is not set in BaseModel")
+		b.log(WARN, "Collection name is not set in BaseModel")
 		return errors.New("collection name not set; ensure the model is properly initialized")
 	}
-	Log(DEBUG, "Collection name '%s' is properly set", b.CollectionName)
+	b.log(DEBUG, "Collection name '%s' is properly set", b.CollectionName)
 	return nil
 }
+
+// modelInfo returns the registry metadata for this model.
+func (b *BaseModel) modelInfo() (ModelInfo, error) {
+	return b.database().GetModelInfo(b.CollectionName + "." + b.ModelName)
+}
+
+// GetModelInfo returns the registry metadata of the model, such as its schema type.
+func (b *BaseModel) GetModelInfo() (ModelInfo, error) {
+	return b.modelInfo()
+}
@@ -0,0 +1,118 @@
+package firegorm
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// operation tracks a single ORM call so its outcome can be reported with
+// structured attributes once it finishes.
+type operation struct {
+	ctx        context.Context
+	db         *DB
+	name       string
+	collection string
+	docID      string
+	start      time.Time
+	attrs      []Attr
+	span       trace.Span
+	reads      int
+	writes     int
+}
+
+type operationKey struct{}
+
+// startOp begins tracking an operation on this model. docID may be empty for
+// operations that are not about a single document. The returned context
+// carries the operation's span and must be used for the rest of the operation.
+func (b *BaseModel) startOp(ctx context.Context, name, docID string) (context.Context, *operation) {
+	ctx, span := startSpan(ctx, "firegorm."+name,
+		attribute.String("db.operation.name", name),
+		attribute.String("db.collection.name", b.CollectionName),
+		attribute.String("firegorm.model", b.ModelName),
+	)
+	op := &operation{
+		ctx:        ctx,
+		db:         b.database(),
+		name:       name,
+		collection: b.CollectionName,
+		docID:      docID,
+		start:      time.Now(),
+		span:       span,
+	}
+	op.ctx = context.WithValue(ctx, operationKey{}, op)
+	return op.ctx, op
+}
+
+// addReads counts document reads against the operation running in ctx.
+func addReads(ctx context.Context, n int) {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		op.reads += n
+	}
+}
+
+// addWrites counts document writes against the operation running in ctx.
+func addWrites(ctx context.Context, n int) {
+	if op, ok := ctx.Value(operationKey{}).(*operation); ok {
+		op.writes += n
+	}
+}
+
+// set attaches an extra attribute, such as a result count, to the operation.
+func (op *operation) set(key string, value interface{}) {
+	op.attrs = append(op.attrs, Attr{Key: key, Value: value})
+}
+
+// setFilters records which filter keys the operation used.
+func (op *operation) setFilters(filters map[string]interface{}) {
+	if len(filters) > 0 {
+		op.set("filter_keys", sortedKeys(filters))
+	}
+}
+
+// end reports the outcome of the operation and ends its span.
+func (op *operation) end(err error) {
+	if op.docID != "" {
+		op.span.SetAttributes(attribute.String("firegorm.doc_id", op.docID))
+	}
+	for _, a := range op.attrs {
+		op.span.SetAttributes(spanAttribute(a.Key, a.Value))
+	}
+	endSpan(op.span, err)
+
+	duration := time.Since(op.start)
+	m := metrics.load()
+	m.ObserveOperation(op.collection, op.name, duration, err)
+	if op.reads > 0 {
+		m.AddReads(op.collection, op.name, op.reads)
+	}
+	if op.writes > 0 {
+		m.AddWrites(op.collection, op.name, op.writes)
+	}
+
+	attrs := []Attr{
+		{Key: "operation", Value: op.name},
+		{Key: "collection", Value: op.collection},
+	}
+	if op.docID != "" {
+		attrs = append(attrs, Attr{Key: "doc_id", Value: op.docID})
+	}
+	attrs = append(attrs, Attr{Key: "duration", Value: duration})
+	if op.reads > 0 {
+		attrs = append(attrs, Attr{Key: "reads", Value: op.reads})
+	}
+	if op.writes > 0 {
+		attrs = append(attrs, Attr{Key: "writes", Value: op.writes})
+	}
+	attrs = append(attrs, op.attrs...)
+
+	if err != nil {
+		attrs = append(attrs, Attr{Key: "error", Value: err.Error()})
+		op.db.logCtx(op.ctx, ERROR, "firegorm operation failed", attrs...)
+		return
+	}
+	op.db.logCtx(op.ctx, DEBUG, "firegorm operation completed", attrs...)
+}
@@ -0,0 +1,127 @@
+package firegorm
+
+import (
+	"slices"
+
+	"cloud.google.com/go/firestore"
+)
+
+// QueryOption customizes read operations such as Get, FindOne and List.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	preload        []string
+	pageSize       int
+	selectFields   []string
+	sort           []string
+	includeDeleted bool
+	where          []string
+	whereFilters   []firestore.EntityFilter
+}
+
+func newQueryOptions(opts []QueryOption) queryOptions {
+	var o queryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Preload eagerly loads the named relation fields (as declared with the
+// `firegorm:"belongs_to:..."` and `firegorm:"has_many:..."` tags) on the results.
+func Preload(relations ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.preload = append(o.preload, relations...)
+	}
+}
+
+// PageSize sets how many documents Each and Iter fetch per round trip.
+func PageSize(n int) QueryOption {
+	return func(o *queryOptions) {
+		o.pageSize = n
+	}
+}
+
+// Select limits the fields downloaded by List, FindOne, Each and Iter to the
+// given Firestore field names. Fields that are not selected keep their zero
+// value in the results. The "id" field is always included so pagination keeps working,
+// and Each and Iter also download the sort fields they resume pages from.
+func Select(fields ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.selectFields = append(o.selectFields, fields...)
+	}
+}
+
+// IncludeDeleted makes List, FindOne, Each and Iter also return soft-deleted documents.
+func IncludeDeleted() QueryOption {
+	return func(o *queryOptions) {
+		o.includeDeleted = true
+	}
+}
+
+// Where filters List, FindOne, Each and Iter with a filter expression, in
+// addition to the filters map. See ParseFilterExpr for the syntax.
+func Where(expr string) QueryOption {
+	return func(o *queryOptions) {
+		o.where = append(o.where, expr)
+	}
+}
+
+// WhereFilter filters List, FindOne, Each and Iter with a Firestore filter,
+// such as one returned by ParseFilterExpr.
+func WhereFilter(filter firestore.EntityFilter) QueryOption {
+	return func(o *queryOptions) {
+		o.whereFilters = append(o.whereFilters, filter)
+	}
+}
+
+// baseFieldNames are the Firestore fields every BaseModel document has.
+var baseFieldNames = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted":    true,
+	"deleted_at": true,
+}
+
+// cursorFields returns the selected fields plus the sort fields missing from
+// them: Each resumes every page from the sort values of the last document, so
+// a projection must carry them.
+func cursorFields(fields []string, clauses []SortField) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	selected := append([]string(nil), fields...)
+	for _, clause := range clauses {
+		if clause.Field != "id" && !slices.Contains(selected, clause.Field) {
+			selected = append(selected, clause.Field)
+		}
+	}
+	return selected
+}
+
+// applySelect validates the selected fields against the registered model and
+// restricts the query to them. It returns the query unchanged if none are selected.
+func (b *BaseModel) applySelect(query firestore.Query, fields []string) (firestore.Query, error) {
+	if len(fields) == 0 {
+		return query, nil
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		return query, err
+	}
+
+	paths := []string{"id"}
+	for _, field := range fields {
+		if _, ok := info.TagToFieldMap[field]; !ok && !baseFieldNames[field] {
+			return query, invalid(field, "cannot select field '%s': it does not exist in the model for collection '%s'", field, b.CollectionName)
+		}
+		if field != "id" {
+			paths = append(paths, field)
+		}
+	}
+
+	b.log(DEBUG, "Selecting fields %v from collection '%s'", paths, b.CollectionName)
+	return query.Select(paths...), nil
+}
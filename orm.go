@@ -32,92 +32,123 @@ func ValidateStruct(data interface{}) error {
 
 		// Check for "required" tag
 		if tag == "required" && value.IsZero() {
-			err := fmt.Errorf("field '%s' is required", field.Name)
+			err := invalid(field.Name, "field '%s' is required", field.Name)
 			Log(ERROR, "Validation failed: %v", err)
 			return err
 		}
 	}
 
-	Log(DEBUG, "Struct validation passed for %+v", data)
+	Log(DEBUG, "Struct validation passed for %+v", redact(data, nil))
 	return nil
 }
 
 // Create inserts a new document into the model's collection.
-func (b *BaseModel) Create(ctx context.Context, data interface{}) error {
+func (b *BaseModel) Create(ctx context.Context, data interface{}) (err error) {
+	ctx, op := b.startOp(ctx, "Create", "")
+	defer func() { op.end(err) }()
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "Create failed: %v", err)
+		b.logf(ctx, ERROR, "Create failed: %v", err)
 		return err
 	}
 
-	if err := ValidateStruct(data); err != nil {
+	col, err := b.collectionRef(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Create failed: %v", err)
 		return err
 	}
 
 	val := reflect.ValueOf(data)
 	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
 		err := fmt.Errorf("data must be a pointer to a struct")
-		Log(ERROR, "Create failed: %v", err)
+		b.logf(ctx, ERROR, "Create failed: %v", err)
 		return err
 	}
 
-	// Set ID and timestamps
-	b.setID(generateUUID())
-	b.setTimestamps()
+	if err := b.stampTenant(ctx, val.Elem()); err != nil {
+		b.logf(ctx, ERROR, "Create failed: %v", err)
+		return err
+	}
 
-	val = val.Elem()
-	val.FieldByName("ID").SetString(b.ID)
-	val.FieldByName("CreatedAt").Set(reflect.ValueOf(b.CreatedAt))
-	val.FieldByName("UpdatedAt").Set(reflect.ValueOf(b.UpdatedAt))
-	val.FieldByName("DeletedAt").Set(reflect.Zero(val.FieldByName("DeletedAt").Type()))
-	val.FieldByName("Deleted").SetBool(false)
+	if err := ValidateStruct(data); err != nil {
+		return err
+	}
+
+	// Set ID and timestamps on the document only; the model handle is shared.
+	id, err := prepareCreate(val.Elem(), b.database().now())
+	if err != nil {
+		b.logf(ctx, ERROR, "Create failed: %v", err)
+		return err
+	}
+	op.docID = id
 
-	Log(INFO, "Creating document in collection '%s': %+v", b.CollectionName, data)
+	b.logf(ctx, INFO, "Creating document in collection '%s': %+v", col.Path, redact(data, nil))
 	// after you’ve set ID & timestamps but before Set(ctx,…):
-	if err := DefaultRegistry.RunHooks(ctx, b.CollectionName, PreCreate, data); err != nil {
+	if err := b.database().Hooks().RunHooks(ctx, b.CollectionName, PreCreate, data); err != nil {
 		return err
 	}
-	_, err := Client.Collection(b.CollectionName).Doc(b.ID).Set(ctx, data)
-	_ = DefaultRegistry.RunHooks(ctx, b.CollectionName, PostCreate, data)
+	err = b.database().createDoc(ctx, col.Doc(id), data)
+	if err == nil {
+		addWrites(ctx, 1)
+	}
+	_ = b.database().Hooks().RunHooks(ctx, b.CollectionName, PostCreate, data)
 	return err
 }
 
 // Get retrieves a document by ID and maps it to the provided model.
-func (b *BaseModel) Get(ctx context.Context, id string, model interface{}) error {
+func (b *BaseModel) Get(ctx context.Context, id string, model interface{}, opts ...QueryOption) (err error) {
+	ctx, op := b.startOp(ctx, "Get", id)
+	defer func() { op.end(err) }()
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "Get failed: %v", err)
+		b.logf(ctx, ERROR, "Get failed: %v", err)
 		return err
 	}
 
-	doc, err := Client.Collection(b.CollectionName).Doc(id).Get(ctx)
+	doc, err := b.getDoc(ctx, id)
+	addReads(ctx, 1)
 	if err != nil {
-		Log(ERROR, "Failed to fetch document with ID '%s' from collection '%s': %v", id, b.CollectionName, err)
+		b.logf(ctx, ERROR, "Failed to fetch document with ID '%s' from collection '%s': %v", id, b.CollectionName, err)
 		return err
 	}
 
 	if deleted, ok := doc.Data()["deleted"].(bool); ok && deleted {
-		err := fmt.Errorf("document with ID '%s' has been deleted", id)
-		Log(WARN, "Get failed: %v", err)
+		err := notFound("document with ID '%s' has been deleted", id)
+		b.logf(ctx, WARN, "Get failed: %v", err)
 		return err
 	}
 
 	if err := doc.DataTo(model); err != nil {
-		Log(ERROR, "Failed to map document data to model: %v", err)
+		b.logf(ctx, ERROR, "Failed to map document data to model: %v", err)
 		return err
 	}
 
-	Log(INFO, "Fetched document from collection '%s': %+v", b.CollectionName, model)
+	options := newQueryOptions(opts)
+	if err := b.preload(ctx, []reflect.Value{structValue(reflect.ValueOf(model))}, options.preload); err != nil {
+		return err
+	}
+
+	b.logf(ctx, INFO, "Fetched document from collection '%s': %+v", b.CollectionName, redact(model, nil))
 	return nil
 }
 
 // FindOneBy retrieves a single document from the collection that matches the given property and value.
-func (b *BaseModel) FindOneBy(ctx context.Context, property string, value interface{}, model interface{}) error {
+func (b *BaseModel) FindOneBy(ctx context.Context, property string, value interface{}, model interface{}) (err error) {
+	ctx, op := b.startOp(ctx, "FindOneBy", "")
+	defer func() { op.end(err) }()
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "FindOneBy failed: %v", err)
+		b.logf(ctx, ERROR, "FindOneBy failed: %v", err)
 		return err
 	}
 
 	// Build the query: only non-deleted documents are considered.
-	query := Client.Collection(b.CollectionName).
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "FindOneBy failed: %v", err)
+		return err
+	}
+	query = query.
 		Where(property, "==", value).
 		Where("deleted", "==", false).
 		Limit(1)
@@ -126,43 +157,75 @@ func (b *BaseModel) FindOneBy(ctx context.Context, property string, value interf
 	defer iter.Stop()
 
 	doc, err := iter.Next()
+	addReads(ctx, 1)
 	if err == iterator.Done {
-		err = fmt.Errorf("no document found for %s == %v", property, value)
-		Log(WARN, "FindOneBy: %v", err)
+		err = notFound("no document found by '%s'", property)
+		b.logf(ctx, WARN, "FindOneBy: %v", err)
 		return err
 	}
 	if err != nil {
-		Log(ERROR, "Error executing query in FindOneBy: %v", err)
+		b.logf(ctx, ERROR, "Error executing query in FindOneBy: %v", err)
 		return err
 	}
 
 	if err := doc.DataTo(model); err != nil {
-		Log(ERROR, "Failed to map document data to model in FindOneBy: %v", err)
+		b.logf(ctx, ERROR, "Failed to map document data to model in FindOneBy: %v", err)
 		return err
 	}
 
-	Log(INFO, "Found document by %s == %v in collection '%s': %+v", property, value, b.CollectionName, model)
+	b.logf(ctx, INFO, "Found document by %v in collection '%s': %+v", redact(map[string]interface{}{property: value}, b.sensitiveKeys()), b.CollectionName, redact(model, nil))
 	return nil
 }
 
 // FindOne retrieves a single document from the collection that matches the given filters.
 // FindOne retrieves a single document from the collection that matches the given filters.
-func (b *BaseModel) FindOne(ctx context.Context, filters map[string]interface{}, model interface{}) error {
+func (b *BaseModel) FindOne(ctx context.Context, filters map[string]interface{}, model interface{}, opts ...QueryOption) (err error) {
+	ctx, op := b.startOp(ctx, "FindOne", "")
+	defer func() { op.end(err) }()
+	op.setFilters(filters)
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "FindOne failed: %v", err)
+		b.logf(ctx, ERROR, "FindOne failed: %v", err)
 		return err
 	}
 
-	// Start with a query that excludes deleted documents.
-	query := Client.Collection(b.CollectionName).Where("deleted", "==", false)
+	options := newQueryOptions(opts)
+
+	// Start with a query that excludes deleted documents, unless IncludeDeleted is set.
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "FindOne failed: %v", err)
+		return err
+	}
+	if !options.includeDeleted {
+		query = query.Where("deleted", "==", false)
+	}
 
 	// Apply operator filters (e.g., __gt, __lte) instead of using simple equality.
-	var err error
 	query, err = applyOperatorFilters(query, filters)
 	if err != nil {
-		Log(ERROR, "FindOne failed when applying filters: %v", err)
+		b.logf(ctx, ERROR, "FindOne failed when applying filters: %v", err)
+		return err
+	}
+	query, err = applyWhere(query, options)
+	if err != nil {
+		b.logf(ctx, ERROR, "FindOne failed: %v", err)
+		return err
+	}
+
+	query, err = b.applySelect(query, options.selectFields)
+	if err != nil {
+		b.logf(ctx, ERROR, "FindOne failed: %v", err)
+		return err
+	}
+
+	clauses, err := b.resolveSort("", "", options)
+	if err != nil {
+		b.logf(ctx, ERROR, "FindOne failed: %v", err)
 		return err
 	}
+	query = applySort(query, clauses)
+	b.recordQuery(filters, clauses, options)
 
 	query = query.Limit(1)
 
@@ -170,120 +233,192 @@ func (b *BaseModel) FindOne(ctx context.Context, filters map[string]interface{},
 	defer iter.Stop()
 
 	doc, err := iter.Next()
+	addReads(ctx, 1)
 	if err == iterator.Done {
-		err = fmt.Errorf("no document found matching filters: %v", filters)
-		Log(WARN, "FindOne: %v", err)
+		err = notFound("no document found matching filters on %v", sortedKeys(filters))
+		b.logf(ctx, WARN, "FindOne: %v", err)
 		return err
 	}
 	if err != nil {
-		Log(ERROR, "Error executing query in FindOne: %v", err)
+		b.logf(ctx, ERROR, "Error executing query in FindOne: %v", err)
 		return err
 	}
 
 	if err := doc.DataTo(model); err != nil {
-		Log(ERROR, "Failed to map document data to model in FindOne: %v", err)
+		b.logf(ctx, ERROR, "Failed to map document data to model in FindOne: %v", err)
+		return err
+	}
+
+	if err := b.preload(ctx, []reflect.Value{structValue(reflect.ValueOf(model))}, options.preload); err != nil {
 		return err
 	}
 
-	Log(INFO, "Found document with filters %v in collection '%s': %+v", filters, b.CollectionName, model)
+	b.logf(ctx, INFO, "Found document with filters %v in collection '%s': %+v", redact(filters, b.sensitiveKeys()), b.CollectionName, redact(model, nil))
 	return nil
 }
 
 // Update modifies specific fields of a document.
-func (b *BaseModel) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+func (b *BaseModel) Update(ctx context.Context, id string, updates map[string]interface{}) (err error) {
+	ctx, op := b.startOp(ctx, "Update", id)
+	defer func() { op.end(err) }()
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "Update failed: %v", err)
+		b.logf(ctx, ERROR, "Update failed: %v", err)
 		return err
 	}
 
+	// Work on a copy so the caller's map is never modified.
+	updates = copyUpdates(updates)
+
 	// --- remove immutable fields if they came in the payload ---
 	delete(updates, "id")
 	delete(updates, "created_at")
 
 	// Validate updates using the registry
 	if err := validateUpdateFields(updates, b); err != nil {
-		Log(ERROR, "Update failed: %v", err)
+		b.logf(ctx, ERROR, "Update failed: %v", err)
 		return err
 	}
 
-	// Add Firestore timestamp
-	updates["updated_at"] = firestore.ServerTimestamp
-	Log(INFO, "Updating document ID '%s' in collection '%s' with updates: %+v", id, b.CollectionName, updates)
+	col, err := b.collectionRef(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Update failed: %v", err)
+		return err
+	}
+	if err := b.checkTenant(ctx, id, updates); err != nil {
+		b.logf(ctx, ERROR, "Update failed: %v", err)
+		return err
+	}
+
+	// Add the update timestamp, unless the caller set it (Delete stamps
+	// deleted_at and updated_at with the same time).
+	if _, ok := updates["updated_at"]; !ok {
+		updates["updated_at"] = b.database().timestamp()
+	}
+	b.logf(ctx, INFO, "Updating document ID '%s' in collection '%s' with updates: %+v", id, b.CollectionName, redact(updates, b.sensitiveKeys()))
 
 	// — run pre-update hooks —
-	if err := DefaultRegistry.RunHooks(ctx, b.CollectionName, PreUpdate, updates); err != nil {
+	if err := b.database().Hooks().RunHooks(ctx, b.CollectionName, PreUpdate, updates); err != nil {
 		return err
 	}
 
-	_, err := Client.Collection(b.CollectionName).Doc(id).Update(ctx, updatesToFirestoreUpdates(updates))
+	_, err = col.Doc(id).Update(ctx, updatesToFirestoreUpdates(updates))
+	if err == nil {
+		addWrites(ctx, 1)
+	}
 	// — run post-update hooks —
-	_ = DefaultRegistry.RunHooks(ctx, b.CollectionName, PostUpdate, updates)
+	_ = b.database().Hooks().RunHooks(ctx, b.CollectionName, PostUpdate, updates)
 	return err
 }
 
 // Delete performs a soft delete by marking the document as deleted.
-func (b *BaseModel) Delete(ctx context.Context, id string) error {
+func (b *BaseModel) Delete(ctx context.Context, id string) (err error) {
+	ctx, op := b.startOp(ctx, "Delete", id)
+	defer func() { op.end(err) }()
+
+	if _, err := b.collectionPath(ctx); err != nil {
+		b.logf(ctx, ERROR, "Delete failed: %v", err)
+		return err
+	}
+
 	// — run pre-delete hooks —
-	if err := DefaultRegistry.RunHooks(ctx, b.CollectionName, PreDelete, id); err != nil {
+	if err := b.database().Hooks().RunHooks(ctx, b.CollectionName, PreDelete, id); err != nil {
 		return err
 	}
-	now := time.Now()
+	now := b.database().timestamp()
 	updates := map[string]interface{}{
 		"deleted":    true,
 		"deleted_at": now,
-		"updated_at": firestore.ServerTimestamp,
+		"updated_at": now,
 	}
 	// perform the soft-delete
-	err := b.Update(ctx, id, updates)
+	err = b.Update(ctx, id, updates)
 	// — run post-delete hooks —
 	if err == nil {
-		_ = DefaultRegistry.RunHooks(ctx, b.CollectionName, PostDelete, id)
+		_ = b.database().Hooks().RunHooks(ctx, b.CollectionName, PostDelete, id)
 	}
 	return err
 }
 
+// Restore undoes a soft delete, making the document visible to queries again.
+func (b *BaseModel) Restore(ctx context.Context, id string) (err error) {
+	ctx, op := b.startOp(ctx, "Restore", id)
+	defer func() { op.end(err) }()
+
+	if _, err := b.collectionPath(ctx); err != nil {
+		b.logf(ctx, ERROR, "Restore failed: %v", err)
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"deleted":    false,
+		"deleted_at": nil,
+	}
+	return b.Update(ctx, id, updates)
+}
+
 // List retrieves documents with optional filters, sorting, and pagination.
-func (b *BaseModel) List(ctx context.Context, filters map[string]interface{}, limit int, startAfter string, sortField string, sortOrder string, results interface{}) (string, error) {
+func (b *BaseModel) List(ctx context.Context, filters map[string]interface{}, limit int, startAfter string, sortField string, sortOrder string, results interface{}, opts ...QueryOption) (nextPageToken string, err error) {
+	ctx, op := b.startOp(ctx, "List", "")
+	defer func() { op.end(err) }()
+	op.setFilters(filters)
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "List failed: %v", err)
+		b.logf(ctx, ERROR, "List failed: %v", err)
 		return "", err
 	}
 
-	// Start with the query: only non-deleted documents.
-	query := Client.Collection(b.CollectionName).Where("deleted", "==", false)
+	options := newQueryOptions(opts)
+
+	// Start with the query: only non-deleted documents, unless IncludeDeleted is set.
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "List failed: %v", err)
+		return "", err
+	}
+	if !options.includeDeleted {
+		query = query.Where("deleted", "==", false)
+	}
 
 	// Apply operator filters (supports __gt, __gte, __lt, __lte for any field, including custom date fields)
-	var err error
 	query, err = applyOperatorFilters(query, filters)
 	if err != nil {
-		Log(ERROR, "List failed when applying filters: %v", err)
+		b.logf(ctx, ERROR, "List failed when applying filters: %v", err)
+		return "", err
+	}
+	query, err = applyWhere(query, options)
+	if err != nil {
+		b.logf(ctx, ERROR, "List failed: %v", err)
 		return "", err
 	}
 
-	// Apply sorting if sortField is provided.
-	if sortField != "" {
-		if sortOrder == "asc" {
-			query = query.OrderBy(sortField, firestore.Asc)
-		} else if sortOrder == "desc" {
-			query = query.OrderBy(sortField, firestore.Desc)
-		} else {
-			err := fmt.Errorf("invalid sortOrder: %s. Must be 'asc' or 'desc'", sortOrder)
-			Log(ERROR, "List failed: %v", err)
-			return "", err
-		}
+	query, err = b.applySelect(query, options.selectFields)
+	if err != nil {
+		b.logf(ctx, ERROR, "List failed: %v", err)
+		return "", err
 	}
 
+	// Apply sorting: sortField/sortOrder, SortBy options or the model's default sort.
+	clauses, err := b.resolveSort(sortField, sortOrder, options)
+	if err != nil {
+		b.logf(ctx, ERROR, "List failed: %v", err)
+		return "", err
+	}
+	query = applySort(query, clauses)
+	b.recordQuery(filters, clauses, options)
+
 	// If a startAfter token is provided, use it for pagination.
 	if startAfter != "" {
-		doc, err := Client.Collection(b.CollectionName).Doc(startAfter).Get(ctx)
+		doc, err := b.getDoc(ctx, startAfter)
+		addReads(ctx, 1)
 		if err != nil {
-			err = fmt.Errorf("invalid startAfter token: %v", err)
-			Log(ERROR, "List failed: %v", err)
+			err = invalid("startAfter", "invalid startAfter token: %v", err)
+			b.logf(ctx, ERROR, "List failed: %v", err)
 			return "", err
 		}
-		if deleted, ok := doc.Data()["deleted"].(bool); ok && deleted {
-			err = fmt.Errorf("invalid startAfter token: document '%s' is deleted", startAfter)
-			Log(ERROR, "List failed: %v", err)
+		if deleted, ok := doc.Data()["deleted"].(bool); ok && deleted && !options.includeDeleted {
+			err = invalid("startAfter", "invalid startAfter token: document '%s' is deleted", startAfter)
+			b.logf(ctx, ERROR, "List failed: %v", err)
 			return "", err
 		}
 		query = query.StartAfter(doc)
@@ -300,20 +435,21 @@ func (b *BaseModel) List(ctx context.Context, filters map[string]interface{}, li
 	resultsVal := reflect.ValueOf(results).Elem()
 	itemType := resultsVal.Type().Elem()
 
+	fetched := 0
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			Log(ERROR, "Failed to iterate documents: %v", err)
+			b.logf(ctx, ERROR, "Failed to iterate documents: %v", err)
 			return "", fmt.Errorf("failed to iterate documents: %v", err)
 		}
 
 		// Create a new item and map Firestore document data to it.
 		item := reflect.New(itemType).Interface()
 		if err := doc.DataTo(item); err != nil {
-			Log(ERROR, "Failed to map document data: %v", err)
+			b.logf(ctx, ERROR, "Failed to map document data: %v", err)
 			return "", fmt.Errorf("failed to map document data: %v", err)
 		}
 
@@ -323,27 +459,48 @@ func (b *BaseModel) List(ctx context.Context, filters map[string]interface{}, li
 		}
 
 		resultsVal.Set(reflect.Append(resultsVal, reflect.ValueOf(item)))
+		fetched++
 	}
+	addReads(ctx, max(fetched, 1))
 
-	nextPageToken := ""
+	if len(options.preload) > 0 {
+		items := make([]reflect.Value, resultsVal.Len())
+		for i := range items {
+			items[i] = structValue(resultsVal.Index(i))
+		}
+		if err := b.preload(ctx, items, options.preload); err != nil {
+			return "", err
+		}
+	}
+
+	nextPageToken = ""
 	// Only set nextPageToken if a limit was applied.
 	if limit > 0 && resultsVal.Len() == limit {
 		lastItem := resultsVal.Index(resultsVal.Len() - 1).Interface()
 		nextPageToken = reflect.ValueOf(lastItem).FieldByName("ID").String()
 	}
 
-	Log(INFO, "Listed documents from collection '%s': %+v", b.CollectionName, results)
+	op.set("result_count", resultsVal.Len())
+	b.logf(ctx, INFO, "Listed documents from collection '%s': %+v", b.CollectionName, redact(results, nil))
 	return nextPageToken, nil
 }
 
-func (b *BaseModel) Last(ctx context.Context, model interface{}) error {
+func (b *BaseModel) Last(ctx context.Context, model interface{}) (err error) {
+	ctx, op := b.startOp(ctx, "Last", "")
+	defer func() { op.end(err) }()
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "Last failed: %v", err)
+		b.logf(ctx, ERROR, "Last failed: %v", err)
 		return err
 	}
 
 	// Query for documents that are not deleted, ordered by creation time descending.
-	query := Client.Collection(b.CollectionName).
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Last failed: %v", err)
+		return err
+	}
+	query = query.
 		Where("deleted", "==", false).
 		OrderBy("created_at", firestore.Desc).
 		Limit(1)
@@ -352,76 +509,91 @@ func (b *BaseModel) Last(ctx context.Context, model interface{}) error {
 	defer iter.Stop()
 
 	doc, err := iter.Next()
+	addReads(ctx, 1)
 	if err == iterator.Done {
-		Log(WARN, "No records found in collection '%s'", b.CollectionName)
-		return errors.New("no records found")
+		b.logf(ctx, WARN, "No records found in collection '%s'", b.CollectionName)
+		return notFound("no records found")
 	}
 	if err != nil {
-		Log(ERROR, "Error fetching last record: %v", err)
+		b.logf(ctx, ERROR, "Error fetching last record: %v", err)
 		return err
 	}
 
 	if err := doc.DataTo(model); err != nil {
-		Log(ERROR, "Error mapping document data to model: %v", err)
+		b.logf(ctx, ERROR, "Error mapping document data to model: %v", err)
 		return err
 	}
 
-	Log(INFO, "Fetched last record from collection '%s': %+v", b.CollectionName, model)
+	b.logf(ctx, INFO, "Fetched last record from collection '%s': %+v", b.CollectionName, redact(model, nil))
 	return nil
 }
 
 // Count retrieves the number of documents in the collection that match the provided filters.
-func (b *BaseModel) Count(ctx context.Context, filters map[string]interface{}) (int, error) {
+func (b *BaseModel) Count(ctx context.Context, filters map[string]interface{}) (count int, err error) {
+	ctx, op := b.startOp(ctx, "Count", "")
+	defer func() { op.end(err) }()
+	op.setFilters(filters)
+
 	if err := b.EnsureCollection(); err != nil {
-		Log(ERROR, "Count failed: %v", err)
+		b.logf(ctx, ERROR, "Count failed: %v", err)
 		return 0, err
 	}
 
 	// Start with a query that excludes deleted documents.
-	query := Client.Collection(b.CollectionName).Where("deleted", "==", false)
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Count failed: %v", err)
+		return 0, err
+	}
+	query = query.Where("deleted", "==", false)
 
 	// Apply operator filters for range comparisons.
-	var err error
 	query, err = applyOperatorFilters(query, filters)
 	if err != nil {
-		Log(ERROR, "Count failed when applying filters: %v", err)
+		b.logf(ctx, ERROR, "Count failed when applying filters: %v", err)
 		return 0, err
 	}
+	b.recordQuery(filters, nil, queryOptions{})
 
 	iter := query.Documents(ctx)
 	defer iter.Stop()
 
-	count := 0
+	count = 0
 	for {
 		_, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			Log(ERROR, "Error iterating documents for count: %v", err)
+			b.logf(ctx, ERROR, "Error iterating documents for count: %v", err)
 			return 0, err
 		}
 		count++
 	}
 
-	Log(INFO, "Counted %d documents in collection '%s' with filters: %v", count, b.CollectionName, filters)
+	addReads(ctx, max(count, 1))
+	op.set("result_count", count)
+	b.logf(ctx, INFO, "Counted %d documents in collection '%s' with filters: %v", count, b.CollectionName, redact(filters, b.sensitiveKeys()))
 	return count, nil
 }
 
-func (b *BaseModel) setID(id string) {
-	b.ID = id
-	Log(DEBUG, "Set ID for model: %s", id)
-}
-
-func (b *BaseModel) setTimestamps() {
-	now := time.Now()
-	if b.CreatedAt.IsZero() {
-		b.CreatedAt = now
+// prepareCreate sets a new ID and fresh timestamps on a document about to be
+// created and returns the ID.
+func prepareCreate(doc reflect.Value, now time.Time) (string, error) {
+	for _, name := range []string{"ID", "CreatedAt", "UpdatedAt", "Deleted", "DeletedAt"} {
+		if !doc.FieldByName(name).IsValid() {
+			return "", fmt.Errorf("data of type '%s' has no %s field; embed firegorm.BaseModel", doc.Type(), name)
+		}
 	}
-	// Leave UpdatedAt as nil on creation.
-	b.UpdatedAt = &now
-	b.DeletedAt = nil
-	Log(DEBUG, "Set timestamps: CreatedAt=%v, UpdatedAt=%v", b.CreatedAt, b.UpdatedAt)
+
+	id := generateUUID()
+	doc.FieldByName("ID").SetString(id)
+	doc.FieldByName("CreatedAt").Set(reflect.ValueOf(now))
+	doc.FieldByName("UpdatedAt").Set(reflect.ValueOf(&now))
+	doc.FieldByName("Deleted").SetBool(false)
+	doc.FieldByName("DeletedAt").Set(reflect.Zero(doc.FieldByName("DeletedAt").Type()))
+	Log(DEBUG, "Set ID '%s' and timestamps for new document: CreatedAt=%v", id, now)
+	return id, nil
 }
 
 // validateUpdateFields validates the fields being updated based on the struct's tags.
@@ -430,7 +602,7 @@ func validateUpdateFields(updates map[string]interface{}, baseModel *BaseModel)
 	modelName := baseModel.ModelName
 
 	// Retrieve metadata from the registry
-	modelInfo, err := GetModelInfo(collectionName + "." + modelName)
+	modelInfo, err := baseModel.database().GetModelInfo(collectionName + "." + modelName)
 	if err != nil {
 		Log(ERROR, "Validation failed: %v", err)
 		return fmt.Errorf("collection '%s' is not registered", collectionName)
@@ -452,7 +624,7 @@ func validateUpdateFields(updates map[string]interface{}, baseModel *BaseModel)
 
 		fieldName, exists := modelInfo.TagToFieldMap[updateKey]
 		if !exists {
-			err = fmt.Errorf("field '%s' does not exist in the model for collection '%s'", updateKey, collectionName)
+			err = invalid(updateKey, "field '%s' does not exist in the model for collection '%s'", updateKey, collectionName)
 			Log(ERROR, "%v", err)
 			return err
 		}
@@ -461,16 +633,22 @@ func validateUpdateFields(updates map[string]interface{}, baseModel *BaseModel)
 		field, _ := modelInfo.Schema.FieldByName(fieldName)
 		validateTag := field.Tag.Get("validate")
 		if validateTag == "required" && (value == nil || (reflect.ValueOf(value).Kind() == reflect.String && value == "")) {
-			err = fmt.Errorf("field '%s' is required and cannot be empty or nil", updateKey)
+			err = invalid(updateKey, "field '%s' is required and cannot be empty or nil", updateKey)
 			Log(ERROR, "%v", err)
 			return err
 		}
 	}
 
-	Log(DEBUG, "Validation passed for updates: %+v", updates)
+	Log(DEBUG, "Validation passed for updates: %+v", redact(updates, modelInfo.SensitiveFields))
 	return nil
 }
 
+// ApplyFilters adds filters written in the notation of List and
+// ExtractFilters to a Firestore query, for code that works on raw collections.
+func ApplyFilters(query firestore.Query, filters map[string]interface{}) (firestore.Query, error) {
+	return applyOperatorFilters(query, filters)
+}
+
 // applyOperatorFilters applies filters that use an operator notation (e.g., "__gt", "__lte").
 // If a filter value is a string, it attempts to parse it as a date using the "2006-01-02" layout.
 func applyOperatorFilters(query firestore.Query, filters map[string]interface{}) (firestore.Query, error) {
@@ -578,7 +756,7 @@ func parseFilter(key string, value interface{}) (field, op string, newValue inte
 		}
 
 		// truly invalid date for an operator filter:
-		return "", "", nil, fmt.Errorf("invalid date format for %s: %q", key, str)
+		return "", "", nil, invalid(key, "invalid date format for %s", key)
 	}
 
 	// non-string values pass straight through
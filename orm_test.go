@@ -2,12 +2,28 @@
 package firegorm
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/firestore"
 	"github.com/google/uuid"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TestMain initializes the logger before any tests are run.
@@ -129,6 +145,8 @@ func TestParseFilter_InvalidDate(t *testing.T) {
 	_, _, _, err := parseFilter("birthdate__lt", "invalid-date")
 	if err == nil {
 		t.Error("expected error for invalid date format, got nil")
+	} else if strings.Contains(err.Error(), "invalid-date") {
+		t.Errorf("expected the error not to contain the filter value, got %v", err)
 	}
 }
 
@@ -144,7 +162,7 @@ type DummyModel struct {
 
 func TestValidateUpdateFields_Success(t *testing.T) {
 	// Clear registry to ensure isolation
-	modelRegistry = make(map[string]ModelInfo)
+	modelRegistry = NewModelRegistry()
 
 	dummy := DummyModel{}
 	// Register the dummy model.
@@ -166,7 +184,7 @@ func TestValidateUpdateFields_Success(t *testing.T) {
 
 func TestValidateUpdateFields_Failure(t *testing.T) {
 	// Clear registry to ensure isolation
-	modelRegistry = make(map[string]ModelInfo)
+	modelRegistry = NewModelRegistry()
 
 	dummy := DummyModel{}
 	// Register the dummy model.
@@ -185,3 +203,2165 @@ func TestValidateUpdateFields_Failure(t *testing.T) {
 		t.Error("expected error for invalid update field, got nil")
 	}
 }
+
+// --- Test for diffKnown ---
+// diffKnown turns a reconnect snapshot into the changes missed while disconnected.
+func TestDiffKnown(t *testing.T) {
+	t0 := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+
+	before := map[string]time.Time{"same": t0, "changed": t0, "gone": t0}
+	after := map[string]time.Time{"same": t0, "changed": t1, "new": t1}
+
+	got := make(map[string]ChangeType)
+	for _, d := range diffKnown(before, after) {
+		got[d.id] = d.kind
+	}
+	expected := map[string]ChangeType{
+		"changed": ChangeModified,
+		"new":     ChangeAdded,
+		"gone":    ChangeRemoved,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestWatchRetryOf(t *testing.T) {
+	tests := map[codes.Code]watchRetry{
+		codes.Unavailable:      retryAlways,
+		codes.DeadlineExceeded: retryAlways,
+		codes.Internal:         retryUncertain,
+		codes.Unknown:          retryUncertain,
+		codes.PermissionDenied: retryNever,
+		codes.NotFound:         retryNever,
+	}
+	for code, expected := range tests {
+		if got := watchRetryOf(status.Error(code, "boom")); got != expected {
+			t.Errorf("%v: expected %v, got %v", code, expected, got)
+		}
+	}
+	if watchRetryOf(nil) != retryAlways || watchRetryOf(iterator.Done) != retryAlways {
+		t.Error("expected a listener ending on its own to be restarted")
+	}
+	if watchRetryOf(errors.New("failed to map document data: type mismatch")) != retryNever {
+		t.Error("expected errors without a gRPC status not to be retried")
+	}
+}
+
+func TestRunWatch_GivesUpOnUncertainErrors(t *testing.T) {
+	defer func(initial, max time.Duration) { watchInitialBackoff, watchMaxBackoff = initial, max }(watchInitialBackoff, watchMaxBackoff)
+	watchInitialBackoff, watchMaxBackoff = time.Millisecond, 50*time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan ChangeEvent, 1)
+	calls := 0
+	b := &BaseModel{CollectionName: "tasks"}
+	b.runWatch(ctx, ch, func() error {
+		calls++
+		if calls == 2 {
+			return status.Error(codes.Unavailable, "reset")
+		}
+		return status.Error(codes.Internal, "stream broken")
+	})
+
+	if calls != watchMaxUncertainRetries+2 {
+		t.Errorf("expected %d attempts, got %d", watchMaxUncertainRetries+2, calls)
+	}
+	select {
+	case ev := <-ch:
+		if status.Code(ev.Err) != codes.Internal || !strings.Contains(ev.Err.Error(), "giving up") {
+			t.Errorf("expected a final Internal error event, got %v", ev.Err)
+		}
+	default:
+		t.Error("expected a final error event")
+	}
+}
+
+func TestDocumentChange(t *testing.T) {
+	t0 := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	tests := []struct {
+		name           string
+		present, alive bool
+		updated        time.Time
+		expected       ChangeType
+	}{
+		{"created", false, true, t1, ChangeAdded},
+		{"modified", true, true, t1, ChangeModified},
+		{"soft deleted", true, false, t1, ChangeRemoved},
+		{"restored", false, true, t1, ChangeAdded},
+		{"reconnect", true, true, t0, ""},
+		{"still missing", false, false, t1, ""},
+	}
+	for _, tt := range tests {
+		kind, changed := documentChange(tt.present, tt.alive, t0, tt.updated)
+		if kind != tt.expected || changed != (tt.expected != "") {
+			t.Errorf("%s: expected %q, got %q (changed=%v)", tt.name, tt.expected, kind, changed)
+		}
+	}
+}
+
+func TestChangeEvents(t *testing.T) {
+	t0 := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	doc := func(id string) *firestore.DocumentSnapshot {
+		return &firestore.DocumentSnapshot{Ref: &firestore.DocumentRef{ID: id}, UpdateTime: t0}
+	}
+	// The query filters on deleted == false, so Firestore reports a soft
+	// delete as a removal and a restore as an addition.
+	snap := &firestore.QuerySnapshot{ReadTime: t0, Changes: []firestore.DocumentChange{
+		{Kind: firestore.DocumentAdded, Doc: doc("restored")},
+		{Kind: firestore.DocumentModified, Doc: doc("edited")},
+		{Kind: firestore.DocumentRemoved, Doc: doc("deleted")},
+	}}
+	known := map[string]time.Time{"edited": t0.Add(-time.Minute), "deleted": t0}
+
+	events, err := changeEvents(snap, known, reflect.TypeOf(dbTask{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := make(map[string]ChangeType)
+	for _, ev := range events {
+		got[ev.ID] = ev.Type
+	}
+	expected := map[string]ChangeType{"restored": ChangeAdded, "edited": ChangeModified, "deleted": ChangeRemoved}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if !reflect.DeepEqual(known, map[string]time.Time{"restored": t0, "edited": t0}) {
+		t.Errorf("unexpected known documents %v", known)
+	}
+}
+
+func TestWatch_SoftDeleteAndRestoreEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "watched")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	doc := &dbTask{Title: "watched"}
+	if err := tasks.Create(ctx, doc); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	single, err := tasks.Watch(ctx, doc.ID)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	query, err := tasks.WatchQuery(ctx, nil)
+	if err != nil {
+		t.Fatalf("WatchQuery failed: %v", err)
+	}
+	next := func(ch <-chan ChangeEvent) ChangeType {
+		select {
+		case ev := <-ch:
+			return ev.Type
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	for name, ch := range map[string]<-chan ChangeEvent{"Watch": single, "WatchQuery": query} {
+		if kind := next(ch); kind != ChangeAdded {
+			t.Errorf("%s: expected the initial document as added, got %q", name, kind)
+		}
+	}
+
+	if err := tasks.Delete(ctx, doc.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for name, ch := range map[string]<-chan ChangeEvent{"Watch": single, "WatchQuery": query} {
+		if kind := next(ch); kind != ChangeRemoved {
+			t.Errorf("%s: expected the soft delete as removed, got %q", name, kind)
+		}
+	}
+
+	if err := tasks.Restore(ctx, doc.ID); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	for name, ch := range map[string]<-chan ChangeEvent{"Watch": single, "WatchQuery": query} {
+		if kind := next(ch); kind != ChangeAdded {
+			t.Errorf("%s: expected the restore as added, got %q", name, kind)
+		}
+	}
+}
+
+// --- Test for subcollection paths ---
+
+func TestParseCollectionTemplate(t *testing.T) {
+	params, err := parseCollectionTemplate("orders/{orderID}/items")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(params, []string{"orderID"}) {
+		t.Errorf("expected [orderID], got %v", params)
+	}
+
+	for _, invalid := range []string{"orders/{orderID}", "orders/abc/items", "{orders}", "orders//items"} {
+		if _, err := parseCollectionTemplate(invalid); err == nil {
+			t.Errorf("expected error for template %q, got nil", invalid)
+		}
+	}
+}
+
+func TestCollectionPath_In(t *testing.T) {
+	items := &BaseModel{CollectionName: "orders/{orderID}/items"}
+
+	if _, err := items.collectionPath(context.Background()); err == nil {
+		t.Error("expected error for unbound subcollection, got nil")
+	}
+
+	path, err := items.In("o1").collectionPath(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "orders/o1/items" {
+		t.Errorf("expected 'orders/o1/items', got '%s'", path)
+	}
+
+	if _, err := items.Group().collectionPath(context.Background()); err == nil {
+		t.Error("expected error for collection group write path, got nil")
+	}
+	if len(items.parentIDs) != 0 {
+		t.Error("expected In to leave the registered model unbound")
+	}
+}
+
+// --- Test for relation tags ---
+
+type relUser struct {
+	BaseModel
+	Name string `firestore:"name" json:"name"`
+}
+
+type relOrder struct {
+	BaseModel
+	UserID string   `firestore:"user_id" json:"user_id"`
+	User   *relUser `firestore:"-" json:"user,omitempty" firegorm:"belongs_to:users,fk=user_id"`
+}
+
+func TestParseFiregormTag(t *testing.T) {
+	directives := parseFiregormTag("belongs_to:users,fk=user_id; sensitive")
+	if len(directives) != 2 {
+		t.Fatalf("expected 2 directives, got %d", len(directives))
+	}
+	if directives[0].Name != "belongs_to" || directives[0].Value != "users" || directives[0].Options["fk"] != "user_id" {
+		t.Errorf("unexpected first directive: %+v", directives[0])
+	}
+	if directives[1].Name != "sensitive" {
+		t.Errorf("expected 'sensitive', got '%s'", directives[1].Name)
+	}
+}
+
+func TestRegisterModel_Relations(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	if _, err := RegisterModel(&relOrder{}, "orders"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	info, err := GetModelInfo("orders.relOrder")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Relation{Kind: BelongsTo, Field: "User", Collection: "users", ForeignKey: "user_id"}
+	if !reflect.DeepEqual(info.Relations["User"], expected) {
+		t.Errorf("expected relation %+v, got %+v", expected, info.Relations["User"])
+	}
+}
+
+func TestRegisterModel_RelationMustNotPersist(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	type badOrder struct {
+		BaseModel
+		User *relUser `firestore:"user" firegorm:"belongs_to:users,fk=user_id"`
+	}
+	if _, err := RegisterModel(&badOrder{}, "orders"); err == nil {
+		t.Error("expected error for persisted relation field, got nil")
+	}
+}
+
+// --- Test for GetMany ---
+
+func TestGetMany_InvalidResults(t *testing.T) {
+	b := &BaseModel{CollectionName: "dummy", ModelName: "DummyModel"}
+	var notASlice DummyModel
+	if _, err := b.GetMany(context.Background(), []string{"a"}, &notASlice); err == nil {
+		t.Error("expected error for non-slice results, got nil")
+	}
+}
+
+func TestPartitionDocs(t *testing.T) {
+	ids := []string{"c", "gone", "a", "deleted", "b"}
+	docs := make([]*firestore.DocumentSnapshot, len(ids))
+	for i, id := range ids {
+		docs[i] = &firestore.DocumentSnapshot{Ref: &firestore.DocumentRef{ID: id}}
+	}
+	found, missing := partitionDocs(ids, docs, func(doc *firestore.DocumentSnapshot) bool {
+		return doc.Ref.ID != "gone" && doc.Ref.ID != "deleted"
+	})
+
+	var order []string
+	for _, doc := range found {
+		order = append(order, doc.Ref.ID)
+	}
+	if !reflect.DeepEqual(order, []string{"c", "a", "b"}) || !reflect.DeepEqual(missing, []string{"gone", "deleted"}) {
+		t.Errorf("expected found [c a b] and missing [gone deleted], got %v and %v", order, missing)
+	}
+}
+
+func TestGetManyAndExistsEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&tenantTask{}, "batch_tasks", WithTenantField("tenant_id"))
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*tenantTask)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	acme, globex := WithTenant(ctx, "acme"), WithTenant(ctx, "globex")
+
+	create := func(ctx context.Context, title string) string {
+		doc := &tenantTask{Title: title}
+		if err := tasks.Create(ctx, doc); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return doc.ID
+	}
+	first, second, deleted := create(acme, "first"), create(acme, "second"), create(acme, "deleted")
+	foreign := create(globex, "foreign")
+	if err := tasks.Delete(acme, deleted); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	var results []*tenantTask
+	missing, err := tasks.GetMany(acme, []string{second, "nope", first, deleted, foreign}, &results)
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Title != "second" || results[1].Title != "first" {
+		t.Errorf("expected second and first in input order, got %+v", results)
+	}
+	if !reflect.DeepEqual(missing, []string{"nope", deleted, foreign}) {
+		t.Errorf("expected missing, deleted and foreign IDs to be missing, got %v", missing)
+	}
+
+	tests := []struct {
+		ctx      context.Context
+		id       string
+		expected bool
+	}{
+		{acme, first, true},
+		{acme, "nope", false},
+		{acme, deleted, false},
+		{acme, foreign, false},
+		{globex, foreign, true},
+	}
+	for _, tt := range tests {
+		if exists, err := tasks.Exists(tt.ctx, tt.id); err != nil || exists != tt.expected {
+			t.Errorf("Exists(%s): expected %v, got %v, %v", tt.id, tt.expected, exists, err)
+		}
+	}
+}
+
+// --- Test for Iter ---
+
+func TestIter_PropagatesSetupError(t *testing.T) {
+	b := &BaseModel{}
+	calls := 0
+	for doc, err := range b.Iter(context.Background(), nil) {
+		calls++
+		if err == nil || doc != nil {
+			t.Errorf("expected a single error for an uninitialized model, got doc=%v err=%v", doc, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 iteration, got %d", calls)
+	}
+}
+
+func TestEach_StopsWhenContextCancelled(t *testing.T) {
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = tasks.Each(ctx, nil, func(doc interface{}) error {
+		t.Error("expected no document after cancellation")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	calls := 0
+	for _, err := range tasks.Iter(ctx, nil) {
+		calls++
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 iteration, got %d", calls)
+	}
+}
+
+func TestEachAndIterEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "stream_tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for i := 0; i < 5; i++ {
+		if err := tasks.Create(ctx, &dbTask{Title: fmt.Sprintf("task %d", i)}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	// Pages of 2 need three round trips, each resuming from a cursor.
+	seen := make(map[string]bool)
+	err = EachOf(ctx, &tasks.BaseModel, nil, func(task *dbTask) error {
+		if seen[task.ID] {
+			t.Errorf("document '%s' streamed twice", task.ID)
+		}
+		seen[task.ID] = true
+		return nil
+	}, PageSize(2))
+	if err != nil || len(seen) != 5 {
+		t.Errorf("expected 5 distinct documents, got %d, %v", len(seen), err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = tasks.Each(ctx, nil, func(doc interface{}) error {
+		calls++
+		if calls == 3 {
+			return stop
+		}
+		return nil
+	}, PageSize(2))
+	if err != stop || calls != 3 {
+		t.Errorf("expected the callback's error after 3 documents, got %d, %v", calls, err)
+	}
+
+	rec := &recordingMetrics{reads: map[string]int{}, writes: map[string]int{}}
+	SetMetrics(rec)
+	defer SetMetrics(nil)
+	calls = 0
+	for _, err := range tasks.Iter(ctx, nil, PageSize(2)) {
+		if err != nil {
+			t.Fatalf("Iter failed: %v", err)
+		}
+		calls++
+		break
+	}
+	if calls != 1 || rec.errors != 0 {
+		t.Errorf("expected a break to stop Iter without an error, got %d call(s) and %d error(s)", calls, rec.errors)
+	}
+
+	// The cursors need the sort field even though only the title is selected.
+	var titles []string
+	err = EachOf(ctx, &tasks.BaseModel, nil, func(task *dbTask) error {
+		titles = append(titles, task.Title)
+		return nil
+	}, Select("title"), SortBy("-created_at"), PageSize(2))
+	if err != nil || !reflect.DeepEqual(titles, []string{"task 4", "task 3", "task 2", "task 1", "task 0"}) {
+		t.Errorf("expected all tasks newest first, got %v, %v", titles, err)
+	}
+}
+
+// --- Test for Select ---
+
+func TestCursorFields(t *testing.T) {
+	clauses := []SortField{{Field: "priority", Direction: firestore.Desc}, {Field: "title"}, {Field: "id"}}
+	if got := cursorFields([]string{"title"}, clauses); !reflect.DeepEqual(got, []string{"title", "priority"}) {
+		t.Errorf("expected the sort field to be selected, got %v", got)
+	}
+	if got := cursorFields(nil, clauses); got != nil {
+		t.Errorf("expected no projection without selected fields, got %v", got)
+	}
+}
+
+func TestApplySelect(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	if _, err := RegisterModel(&DummyModel{}, "dummy"); err != nil {
+		t.Fatalf("failed to register dummy model: %v", err)
+	}
+	b := &BaseModel{CollectionName: "dummy", ModelName: "DummyModel"}
+
+	if _, err := b.applySelect(firestore.Query{}, []string{"field1", "created_at"}); err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+	if _, err := b.applySelect(firestore.Query{}, []string{"unknown"}); err == nil {
+		t.Error("expected error for unknown field, got nil")
+	}
+}
+
+// --- Test for sorting ---
+
+func TestParseSort(t *testing.T) {
+	fields, err := ParseSort("-priority, created_at")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []SortField{
+		{Field: "priority", Direction: firestore.Desc},
+		{Field: "created_at", Direction: firestore.Asc},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+
+	for _, invalid := range []string{"-", "a,a"} {
+		if _, err := ParseSort(invalid); err == nil {
+			t.Errorf("expected error for %q, got nil", invalid)
+		}
+	}
+}
+
+func TestResolveSort(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	if _, err := RegisterModel(&DummyModel{}, "dummy", WithDefaultSort("-created_at")); err != nil {
+		t.Fatalf("failed to register dummy model: %v", err)
+	}
+	b := &BaseModel{CollectionName: "dummy", ModelName: "DummyModel"}
+
+	clauses, err := b.resolveSort("", "", queryOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clauses) != 1 || clauses[0].String() != "-created_at" {
+		t.Errorf("expected default sort '-created_at', got %v", clauses)
+	}
+
+	clauses, err = b.resolveSort("field1", "desc", newQueryOptions([]QueryOption{SortBy("date_field")}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clauses) != 2 || clauses[0].String() != "-field1" || clauses[1].String() != "date_field" {
+		t.Errorf("expected [-field1 date_field], got %v", clauses)
+	}
+
+	if _, err := b.resolveSort("field1", "sideways", queryOptions{}); err == nil {
+		t.Error("expected error for invalid sortOrder, got nil")
+	}
+	if _, err := b.resolveSort("-unknown", "", queryOptions{}); err == nil {
+		t.Error("expected error for unknown sort field, got nil")
+	}
+}
+
+func TestRegisterModel_InvalidDefaultSort(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	if _, err := RegisterModel(&DummyModel{}, "dummy", WithDefaultSort("unknown")); err == nil {
+		t.Error("expected error for unknown default sort field, got nil")
+	}
+}
+
+// --- Test for the pluggable logger ---
+
+type logEntry struct {
+	level LogLevel
+	msg   string
+	attrs []Attr
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (r *recordingLogger) Log(ctx context.Context, level LogLevel, msg string, attrs ...Attr) {
+	r.entries = append(r.entries, logEntry{level: level, msg: msg, attrs: attrs})
+}
+
+func TestSetLogger_StructuredOperation(t *testing.T) {
+	rec := &recordingLogger{}
+	SetLogger(rec)
+	SetLogLevel("DEBUG")
+	defer InitializeLogger()
+
+	b := &BaseModel{CollectionName: "tasks"}
+	ctx := WithRequestID(context.Background(), "req-1")
+	_, op := b.startOp(ctx, "Get", "doc-1")
+	op.end(nil)
+
+	if len(rec.entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d", len(rec.entries))
+	}
+	got := make(map[string]interface{})
+	for _, a := range rec.entries[0].attrs {
+		got[a.Key] = a.Value
+	}
+	for key, expected := range map[string]interface{}{
+		"operation":  "Get",
+		"collection": "tasks",
+		"doc_id":     "doc-1",
+		"request_id": "req-1",
+	} {
+		if got[key] != expected {
+			t.Errorf("expected attribute %s=%v, got %v", key, expected, got[key])
+		}
+	}
+	if _, ok := got["duration"]; !ok {
+		t.Error("expected a duration attribute")
+	}
+}
+
+func TestLog_FiltersByLevel(t *testing.T) {
+	rec := &recordingLogger{}
+	SetLogger(rec)
+	SetLogLevel("WARN")
+	defer InitializeLogger()
+
+	Log(INFO, "hidden %d", 1)
+	Log(ERROR, "shown %d", 2)
+
+	if len(rec.entries) != 1 || rec.entries[0].msg != "shown 2" {
+		t.Errorf("expected only the ERROR entry, got %+v", rec.entries)
+	}
+}
+
+func TestLogf_PassesRequestID(t *testing.T) {
+	rec := &recordingLogger{}
+	SetLogger(rec)
+	defer InitializeLogger()
+
+	b := &BaseModel{CollectionName: "tasks"}
+	b.logf(WithRequestID(context.Background(), "req-2"), INFO, "Fetched %d documents", 3)
+
+	if len(rec.entries) != 1 || rec.entries[0].msg != "Fetched 3 documents" {
+		t.Fatalf("expected the formatted entry, got %+v", rec.entries)
+	}
+	if attrs := rec.entries[0].attrs; len(attrs) != 1 || attrs[0] != (Attr{Key: "request_id", Value: "req-2"}) {
+		t.Errorf("expected the request ID attribute, got %v", attrs)
+	}
+}
+
+func TestSetLogger_Concurrent(t *testing.T) {
+	defer InitializeLogger()
+	defer SetLogPayloads(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetLogger(NewSlogLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			SetLogLevel("ERROR")
+			SetLogPayloads(true)
+		}()
+		go func() {
+			defer wg.Done()
+			Log(DEBUG, "racing")
+			_ = fmt.Sprint(redact(map[string]interface{}{"k": 1}, nil))
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Test for log redaction ---
+
+type secretModel struct {
+	BaseModel
+	Email    string `firestore:"email" json:"email" firegorm:"sensitive"`
+	Token    string `firestore:"token" json:"token" log:"redact"`
+	Nickname string `firestore:"nickname" json:"nickname"`
+}
+
+func TestRedact_Struct(t *testing.T) {
+	doc := &secretModel{Email: "a@b.c", Token: "t0k3n", Nickname: "neo"}
+	doc.ID = "doc-1"
+
+	out := fmt.Sprintf("%+v", redact(doc, nil))
+	for _, leaked := range []string{"a@b.c", "t0k3n"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("expected %q to be redacted, got %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, "neo") || !strings.Contains(out, "doc-1") {
+		t.Errorf("expected non-sensitive fields to be logged, got %s", out)
+	}
+}
+
+func TestRedact_UpdateMap(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	if _, err := RegisterModel(&secretModel{}, "secrets"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	b := &BaseModel{CollectionName: "secrets", ModelName: "secretModel"}
+
+	updates := map[string]interface{}{"email": "x@y.z", "email__in": []string{"q@w.e"}, "nickname": "trinity"}
+	out := fmt.Sprintf("%v", redact(updates, b.sensitiveKeys()))
+	if strings.Contains(out, "x@y.z") || strings.Contains(out, "q@w.e") {
+		t.Errorf("expected email values to be redacted, got %s", out)
+	}
+	if !strings.Contains(out, "trinity") {
+		t.Errorf("expected nickname to be logged, got %s", out)
+	}
+}
+
+func TestRedact_IDsOnly(t *testing.T) {
+	SetLogPayloads(false)
+	defer SetLogPayloads(true)
+
+	doc := &secretModel{Nickname: "neo"}
+	doc.ID = "doc-1"
+	out := fmt.Sprintf("%+v", redact([]*secretModel{doc}, nil))
+	if strings.Contains(out, "neo") || !strings.Contains(out, "doc-1") {
+		t.Errorf("expected only the ID to be logged, got %s", out)
+	}
+}
+
+func TestFindOne_NotFoundOmitsValuesEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	rec := &recordingLogger{}
+	db.SetLogger(rec)
+	instance, err := db.RegisterModel(&secretModel{}, "secrets")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	secrets := instance.(*secretModel)
+
+	ctx := context.Background()
+	err = secrets.FindOneBy(ctx, "email", "a@b.c", &secretModel{})
+	if !IsNotFound(err) || strings.Contains(err.Error(), "a@b.c") {
+		t.Errorf("expected a not found error without the value, got %v", err)
+	}
+	err = secrets.FindOne(ctx, map[string]interface{}{"nickname": "neo"}, &secretModel{})
+	if !IsNotFound(err) || strings.Contains(err.Error(), "neo") {
+		t.Errorf("expected a not found error without the value, got %v", err)
+	}
+	for _, entry := range rec.entries {
+		if strings.Contains(entry.msg, "a@b.c") || strings.Contains(entry.msg, "neo") {
+			t.Errorf("expected no filter value in the logs, got %q", entry.msg)
+		}
+	}
+}
+
+// --- Test for tracing ---
+
+func TestTracing_OperationAndHookSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer SetTracerProvider(nil)
+
+	b := &BaseModel{CollectionName: "tasks", ModelName: "Task"}
+	ctx, op := b.startOp(context.Background(), "List", "")
+	op.setFilters(map[string]interface{}{"status": "open", "due__lt": "2025-05-01"})
+	op.set("result_count", 3)
+
+	hooks := NewHookRegistry()
+	hooks.RegisterHook("tasks", PreCreate, func(ctx context.Context, data interface{}) error { return nil })
+	if err := hooks.RunHooks(ctx, "tasks", PreCreate, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	op.end(errors.New("boom"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	hookSpan, opSpan := spans[0], spans[1]
+	if hookSpan.Name() != "firegorm.hooks.pre_create" || hookSpan.Parent().SpanID() != opSpan.SpanContext().SpanID() {
+		t.Errorf("expected hook span to be a child of the operation span, got %q", hookSpan.Name())
+	}
+	if opSpan.Name() != "firegorm.List" || opSpan.Status().Code != otelcodes.Error {
+		t.Errorf("expected failed firegorm.List span, got %q with status %v", opSpan.Name(), opSpan.Status())
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range opSpan.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	for key, expected := range map[string]string{
+		"db.collection.name":    "tasks",
+		"firegorm.model":        "Task",
+		"firegorm.filter_keys":  `["due__lt","status"]`,
+		"firegorm.result_count": "3",
+	} {
+		if attrs[key] != expected {
+			t.Errorf("expected span attribute %s=%s, got %s", key, expected, attrs[key])
+		}
+	}
+}
+
+func TestSetTracerProvider_Concurrent(t *testing.T) {
+	defer SetTracerProvider(nil)
+	b := &BaseModel{CollectionName: "tasks"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetTracerProvider(sdktrace.NewTracerProvider())
+		}()
+		go func() {
+			defer wg.Done()
+			_, op := b.startOp(context.Background(), "Get", "t1")
+			op.end(nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Test for operation metrics ---
+
+type recordingMetrics struct {
+	observed []string
+	errors   int
+	reads    map[string]int
+	writes   map[string]int
+}
+
+func (m *recordingMetrics) ObserveOperation(collection, operation string, duration time.Duration, err error) {
+	m.observed = append(m.observed, collection+"."+operation)
+	if err != nil {
+		m.errors++
+	}
+}
+
+func (m *recordingMetrics) AddReads(collection, operation string, n int) {
+	m.reads[collection+"."+operation] += n
+}
+
+func (m *recordingMetrics) AddWrites(collection, operation string, n int) {
+	m.writes[collection+"."+operation] += n
+}
+
+func TestMetrics_OperationReadsAndWrites(t *testing.T) {
+	rec := &recordingMetrics{reads: map[string]int{}, writes: map[string]int{}}
+	SetMetrics(rec)
+	defer SetMetrics(nil)
+
+	b := &BaseModel{CollectionName: "tasks"}
+	ctx, op := b.startOp(context.Background(), "List", "")
+	addReads(ctx, 1) // startAfter cursor
+	addReads(ctx, 10)
+	op.end(nil)
+
+	ctx, op = b.startOp(context.Background(), "Create", "")
+	addWrites(ctx, 1)
+	op.end(errors.New("boom"))
+
+	if !reflect.DeepEqual(rec.observed, []string{"tasks.List", "tasks.Create"}) {
+		t.Errorf("unexpected observed operations: %v", rec.observed)
+	}
+	if rec.reads["tasks.List"] != 11 || rec.writes["tasks.Create"] != 1 || rec.errors != 1 {
+		t.Errorf("unexpected metrics: reads=%v writes=%v errors=%d", rec.reads, rec.writes, rec.errors)
+	}
+}
+
+func TestSetMetrics_Concurrent(t *testing.T) {
+	defer SetMetrics(nil)
+	b := &BaseModel{CollectionName: "tasks"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetMetrics(noopMetrics{})
+		}()
+		go func() {
+			defer wg.Done()
+			_, op := b.startOp(context.Background(), "Get", "t1")
+			op.end(nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Test for client configuration ---
+
+func TestInitWithConfig_Emulator(t *testing.T) {
+	if err := InitWithConfig(Config{EmulatorHost: "localhost:8086", DatabaseID: "analytics"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if Client == nil {
+		t.Fatal("expected Client to be initialized")
+	}
+	ref := Client.Collection("tasks").Doc("t1")
+	if !strings.Contains(ref.Path, "projects/"+emulatorProjectID+"/databases/analytics/") {
+		t.Errorf("unexpected document path: %s", ref.Path)
+	}
+
+	if err := Close(); err != nil {
+		t.Errorf("unexpected error closing client: %v", err)
+	}
+	if Client != nil {
+		t.Error("expected Client to be nil after Close")
+	}
+	if err := Close(); err == nil {
+		t.Error("expected error closing an uninitialized client, got nil")
+	}
+}
+
+// --- Test for DB handles ---
+
+type dbTask struct {
+	BaseModel
+	Title string `firestore:"title" json:"title"`
+}
+
+func TestOpen_IsolatedDBs(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	rec := &recordingLogger{}
+	first, err := Open(Config{EmulatorHost: "localhost:8086", ProjectID: "project-a", Logger: rec})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer first.Close()
+	second, err := Open(Config{EmulatorHost: "localhost:8086", ProjectID: "project-b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer second.Close()
+
+	a, err := first.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model with first DB: %v", err)
+	}
+	b, err := second.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("registering the same model with another DB should succeed: %v", err)
+	}
+	if _, err := GetModelInfo("tasks.dbTask"); err == nil {
+		t.Error("expected model to be absent from the default DB")
+	}
+
+	colA, _ := a.(*dbTask).collectionRef(context.Background())
+	colB, _ := b.(*dbTask).collectionRef(context.Background())
+	if !strings.Contains(colA.Path, "projects/project-a/") || !strings.Contains(colB.Path, "projects/project-b/") {
+		t.Errorf("unexpected collection paths: %s, %s", colA.Path, colB.Path)
+	}
+
+	first.Hooks().RegisterHook("tasks", PreCreate, func(ctx context.Context, data interface{}) error {
+		return errors.New("blocked")
+	})
+	if err := second.Hooks().RunHooks(context.Background(), "tasks", PreCreate, nil); err != nil {
+		t.Errorf("hooks of one DB should not run for another: %v", err)
+	}
+
+	SetLogLevel("DEBUG")
+	defer InitializeLogger()
+	rec.entries = nil
+	_, op := a.(*dbTask).startOp(context.Background(), "Get", "t1")
+	op.end(nil)
+	if len(rec.entries) != 1 || rec.entries[0].msg != "firegorm operation completed" {
+		t.Errorf("expected the operation to be logged to the DB's logger, got %+v", rec.entries)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Errorf("unexpected error closing DB: %v", err)
+	}
+	if first.Client() != nil {
+		t.Error("expected client to be nil after Close")
+	}
+}
+
+func TestDefaultDB_UsesGlobals(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	if Default().Hooks() != DefaultRegistry {
+		t.Error("expected the default DB to use DefaultRegistry")
+	}
+	if _, err := RegisterModel(&dbTask{}, "tasks"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	if _, err := Default().GetModelInfo("tasks.dbTask"); err != nil {
+		t.Errorf("expected model registered with RegisterModel to be in the default DB: %v", err)
+	}
+}
+
+// --- Test for model registry ---
+
+func TestModelRegistry_ConcurrentRegister(t *testing.T) {
+	db := &DB{models: NewModelRegistry(), hooks: NewHookRegistry()}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := db.RegisterModel(&dbTask{}, fmt.Sprintf("tasks%d", i%10)); err != nil {
+				errs <- err
+			}
+			db.ListModels()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	if len(db.ListModels()) != 10 {
+		t.Errorf("expected 10 models, got %v", db.ListModels())
+	}
+	failed := 0
+	for range errs {
+		failed++
+	}
+	if failed != 10 {
+		t.Errorf("expected 10 duplicate registrations to fail, got %d", failed)
+	}
+}
+
+func TestModelFor(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	if _, err := RegisterModel(&dbTask{}, "tasks"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	for _, model := range []interface{}{dbTask{}, &dbTask{}, reflect.TypeOf(dbTask{})} {
+		info, err := ModelFor(model)
+		if err != nil {
+			t.Errorf("ModelFor(%T): unexpected error: %v", model, err)
+		} else if info.CollectionName != "tasks" {
+			t.Errorf("ModelFor(%T): expected collection 'tasks', got '%s'", model, info.CollectionName)
+		}
+	}
+
+	if _, err := ModelFor(&relUser{}); err == nil {
+		t.Error("expected error for unregistered type, got nil")
+	}
+	if _, err := RegisterModel(&dbTask{}, "archived_tasks"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	if _, err := ModelFor(&dbTask{}); err == nil || !strings.Contains(err.Error(), "several collections") {
+		t.Errorf("expected ambiguity error, got %v", err)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	if _, err := RegisterModel(&dbTask{}, "tasks"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	if !reflect.DeepEqual(ListModels(), []string{"tasks.dbTask"}) {
+		t.Errorf("unexpected models: %v", ListModels())
+	}
+	if err := Unregister("tasks.dbTask"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ListModels()) != 0 {
+		t.Errorf("expected no models, got %v", ListModels())
+	}
+	if err := Unregister("tasks.dbTask"); err == nil {
+		t.Error("expected error unregistering an unknown model, got nil")
+	}
+	if _, err := RegisterModel(&dbTask{}, "tasks"); err != nil {
+		t.Errorf("expected model to be registered again, got %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	if _, err := RegisterModel(&DummyModel{}, "dummy"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	if _, err := RegisterModel(&relOrder{}, "orders"); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+
+	descriptions := Describe()
+	if len(descriptions) != 2 || descriptions[0].Name != "dummy.DummyModel" || descriptions[1].Name != "orders.relOrder" {
+		t.Fatalf("unexpected descriptions: %+v", descriptions)
+	}
+
+	fields := make(map[string]FieldDescription)
+	for _, f := range descriptions[0].Fields {
+		fields[f.Name] = f
+	}
+	if _, ok := fields["CollectionName"]; ok {
+		t.Error("expected fields not stored in Firestore to be left out")
+	}
+	if f := fields["Field1"]; f.Firestore != "field1" || f.Type != "string" || !reflect.DeepEqual(f.Validate, []string{"required"}) {
+		t.Errorf("unexpected description of Field1: %+v", f)
+	}
+	if f := fields["UpdatedAt"]; f.Firestore != "updated_at" || f.Type != "*time.Time" {
+		t.Errorf("unexpected description of UpdatedAt: %+v", f)
+	}
+
+	for _, f := range descriptions[1].Fields {
+		if f.Name == "User" && (f.Relation == nil || f.Relation.Collection != "users") {
+			t.Errorf("expected User to be described as a relation, got %+v", f)
+		}
+	}
+}
+
+// --- Test for concurrent use of model handles ---
+// Run with -race. The hooks abort each operation before it reaches Firestore.
+
+var errAborted = errors.New("aborted by hook")
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	host := os.Getenv("FIRESTORE_EMULATOR_HOST")
+	if host == "" {
+		host = "localhost:8086"
+	}
+	db, err := Open(Config{EmulatorHost: host, ProjectID: "demo-" + strings.ToLower(uuid.NewString()[:8])})
+	if err != nil {
+		t.Fatalf("failed to open DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestCreate_ConcurrentDoesNotMutateHandle(t *testing.T) {
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	var mu sync.Mutex
+	ids := make(map[string]bool)
+	db.Hooks().RegisterHook("tasks", PreCreate, func(ctx context.Context, data interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids[data.(*dbTask).ID] = true
+		return errAborted
+	})
+
+	const n = 50
+	docs := make([]*dbTask, n)
+	var wg sync.WaitGroup
+	for i := range docs {
+		docs[i] = &dbTask{Title: fmt.Sprintf("task %d", i)}
+		wg.Add(1)
+		go func(doc *dbTask) {
+			defer wg.Done()
+			if err := tasks.Create(context.Background(), doc); !errors.Is(err, errAborted) {
+				t.Errorf("expected hook error, got %v", err)
+			}
+		}(docs[i])
+	}
+	wg.Wait()
+
+	if len(ids) != n {
+		t.Errorf("expected %d distinct IDs, got %d", n, len(ids))
+	}
+	for _, doc := range docs {
+		if doc.ID == "" || doc.CreatedAt.IsZero() || doc.UpdatedAt == nil {
+			t.Errorf("expected ID and timestamps to be set on the document, got %+v", doc.BaseModel)
+		}
+	}
+	if tasks.ID != "" || !tasks.CreatedAt.IsZero() || tasks.UpdatedAt != nil {
+		t.Errorf("expected the model handle to be left untouched, got %+v", tasks.BaseModel)
+	}
+}
+
+func TestUpdate_ConcurrentDoesNotModifyCallerMap(t *testing.T) {
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+	db.Hooks().RegisterHook("tasks", PreUpdate, func(ctx context.Context, data interface{}) error {
+		return errAborted
+	})
+
+	updates := map[string]interface{}{"id": "other", "title": "shared"}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := tasks.Update(context.Background(), "t1", updates); !errors.Is(err, errAborted) {
+				t.Errorf("expected hook error, got %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tasks.In().Delete(context.Background(), "t1")
+		}()
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(updates, map[string]interface{}{"id": "other", "title": "shared"}) {
+		t.Errorf("expected the caller's map to be unchanged, got %v", updates)
+	}
+}
+
+func TestCRUD_ConcurrentEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc := &dbTask{Title: fmt.Sprintf("task %d", i)}
+			if err := tasks.Create(ctx, doc); err != nil {
+				t.Errorf("Create failed: %v", err)
+				return
+			}
+			if err := tasks.Update(ctx, doc.ID, map[string]interface{}{"title": "updated"}); err != nil {
+				t.Errorf("Update failed: %v", err)
+			}
+			fetched := &dbTask{}
+			if err := tasks.Get(ctx, doc.ID, fetched); err != nil || fetched.Title != "updated" {
+				t.Errorf("Get returned %+v, %v", fetched, err)
+			}
+			if err := tasks.Delete(ctx, doc.ID); err != nil {
+				t.Errorf("Delete failed: %v", err)
+			}
+			if _, err := tasks.Count(ctx, nil); err != nil {
+				t.Errorf("Count failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// --- Test for clock and timestamp policy ---
+
+type fixedClock struct{ t time.Time }
+
+func (c fixedClock) Now() time.Time { return c.t }
+
+func TestClock_Timestamps(t *testing.T) {
+	db := openTestDB(t)
+	zone := time.FixedZone("UTC-6", -6*60*60)
+	fixed := time.Date(2024, 5, 1, 6, 30, 0, 0, zone)
+	db.SetClock(fixedClock{fixed})
+
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	var updates []map[string]interface{}
+	db.Hooks().RegisterHook("tasks", PreCreate, func(ctx context.Context, data interface{}) error {
+		return errAborted
+	})
+	db.Hooks().RegisterHook("tasks", PreUpdate, func(ctx context.Context, data interface{}) error {
+		updates = append(updates, data.(map[string]interface{}))
+		return errAborted
+	})
+
+	doc := &dbTask{Title: "clock"}
+	tasks.Create(context.Background(), doc)
+	if !doc.CreatedAt.Equal(fixed) || doc.CreatedAt.Location() != time.UTC || !doc.UpdatedAt.Equal(fixed) {
+		t.Errorf("expected UTC timestamps from the clock, got CreatedAt=%v UpdatedAt=%v", doc.CreatedAt, doc.UpdatedAt)
+	}
+
+	tasks.Update(context.Background(), "t1", map[string]interface{}{"title": "x"})
+	tasks.Delete(context.Background(), "t1")
+	db.SetTimestampPolicy(ServerTimestamps)
+	tasks.Update(context.Background(), "t1", map[string]interface{}{"title": "y"})
+
+	if len(updates) != 3 {
+		t.Fatalf("expected 3 updates, got %d", len(updates))
+	}
+	if got, ok := updates[0]["updated_at"].(time.Time); !ok || !got.Equal(fixed) || got.Location() != time.UTC {
+		t.Errorf("expected updated_at from the clock in UTC, got %v", updates[0]["updated_at"])
+	}
+	if updates[1]["deleted_at"] != updates[1]["updated_at"] {
+		t.Errorf("expected deleted_at and updated_at to match, got %v and %v", updates[1]["deleted_at"], updates[1]["updated_at"])
+	}
+	if updates[2]["updated_at"] != firestore.ServerTimestamp {
+		t.Errorf("expected server timestamp, got %v", updates[2]["updated_at"])
+	}
+}
+
+// tickingClock advances by a second on every call.
+type tickingClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *tickingClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestDelete_KeepsOneTimestamp(t *testing.T) {
+	db := openTestDB(t)
+	db.SetClock(&tickingClock{t: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)})
+	instance, err := db.RegisterModel(&dbTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*dbTask)
+
+	var updates map[string]interface{}
+	db.Hooks().RegisterHook("tasks", PreUpdate, func(ctx context.Context, data interface{}) error {
+		updates = data.(map[string]interface{})
+		return errAborted
+	})
+	tasks.Delete(context.Background(), "t1")
+
+	if updates == nil || updates["deleted_at"] != updates["updated_at"] {
+		t.Errorf("expected deleted_at and updated_at to match, got %v", updates)
+	}
+}
+
+func TestInitWithConfig_KeepsTimestampPolicy(t *testing.T) {
+	SetTimestampPolicy(ServerTimestamps)
+	defer SetTimestampPolicy(ClientTimestamps)
+
+	if err := InitWithConfig(Config{EmulatorHost: "localhost:8086"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer Close()
+	if got := timestampPolicy.load(); got != ServerTimestamps {
+		t.Errorf("expected the timestamp policy to be kept, got %v", got)
+	}
+}
+
+type stampedTask struct {
+	BaseModel
+	Title    string     `firestore:"title"`
+	Note     string     `firestore:"note,omitempty"`
+	Seen     *time.Time `firestore:"seen,serverTimestamp"`
+	Internal string     `firestore:"-"`
+	Count    int
+}
+
+func TestStoredFields(t *testing.T) {
+	doc := &stampedTask{BaseModel: BaseModel{ID: "t1"}, Title: "a", Count: 2}
+	fields := make(map[string]interface{})
+	storedFields(reflect.ValueOf(doc).Elem(), fields)
+
+	if fields["id"] != "t1" || fields["title"] != "a" || fields["Count"] != 2 {
+		t.Errorf("unexpected fields: %v", fields)
+	}
+	if _, ok := fields["note"]; ok {
+		t.Errorf("expected an empty omitempty field to be left out, got %v", fields["note"])
+	}
+	if fields["seen"] != firestore.ServerTimestamp {
+		t.Errorf("expected a zero serverTimestamp field to be the sentinel, got %v", fields["seen"])
+	}
+	if _, ok := fields["Internal"]; ok {
+		t.Error("expected a field tagged \"-\" to be left out")
+	}
+	if _, ok := fields["BaseModel"]; ok {
+		t.Error("expected the embedded BaseModel to be flattened")
+	}
+}
+
+func TestSetClock_Concurrent(t *testing.T) {
+	db := openTestDB(t)
+	defer SetClock(nil)
+	defer SetTimestampPolicy(ClientTimestamps)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetClock(fixedClock{time.Now()})
+			SetTimestampPolicy(ServerTimestamps)
+			db.SetClock(fixedClock{time.Now()})
+			db.SetTimestampPolicy(ServerTimestamps)
+		}()
+		go func() {
+			defer wg.Done()
+			defaultDB.timestamp()
+			db.timestamp()
+			db.now()
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Test for composite indexes ---
+
+type indexedTask struct {
+	BaseModel
+	Status   string   `firestore:"status" json:"status" firegorm:"index:by_status"`
+	Priority int      `firestore:"priority" json:"priority" firegorm:"index:by_status,order=desc"`
+	Tags     []string `firestore:"tags" json:"tags"`
+}
+
+func TestIndexes_Declared(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	_, err := RegisterModel(&indexedTask{}, "projects/{projectID}/tasks",
+		WithIndex("tags:contains", "-created_at"),
+		WithGroupIndex("status", "-created_at"),
+	)
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+
+	var got []string
+	for _, ix := range Indexes() {
+		got = append(got, ix.String())
+	}
+	expected := []string{
+		"tasks(deleted,status,-priority)",
+		"tasks(deleted,tags:contains,-created_at)",
+		"tasks(deleted,status,-created_at) [group]",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected indexes %v, got %v", expected, got)
+	}
+
+	data, err := GenerateIndexes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, fragment := range []string{
+		`"collectionGroup": "tasks"`,
+		`"queryScope": "COLLECTION_GROUP"`,
+		`"arrayConfig": "CONTAINS"`,
+		`"order": "DESCENDING"`,
+		`"fieldOverrides": []`,
+	} {
+		if !strings.Contains(string(data), fragment) {
+			t.Errorf("expected generated file to contain %s, got:\n%s", fragment, data)
+		}
+	}
+
+	if _, err := RegisterModel(&dbTask{}, "tasks", WithIndex("missing")); err == nil {
+		t.Error("expected error for an unknown index field, got nil")
+	}
+}
+
+func TestIndexRecorder(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	instance, err := RegisterModel(&indexedTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*indexedTask)
+
+	rec := NewIndexRecorder()
+	SetIndexRecorder(rec)
+	defer SetIndexRecorder(nil)
+
+	// Covered by the by_status tag index.
+	tasks.recordQuery(map[string]interface{}{"status": "open"}, []SortField{{Field: "priority", Direction: firestore.Desc}}, queryOptions{})
+	// Equality only: no composite index needed.
+	tasks.recordQuery(map[string]interface{}{"status": "open"}, nil, queryOptions{})
+	// Needs an undeclared index, recorded twice.
+	for i := 0; i < 2; i++ {
+		tasks.recordQuery(map[string]interface{}{"status": "open", "priority__gte": 3}, []SortField{{Field: "created_at", Direction: firestore.Desc}}, queryOptions{})
+	}
+
+	queries := rec.Queries()
+	if len(queries) != 3 || queries[2].Count != 2 {
+		t.Fatalf("unexpected recorded queries: %+v", queries)
+	}
+	if !queries[0].Declared || !queries[1].Declared || queries[2].Declared {
+		t.Errorf("unexpected declared flags: %v, %v, %v", queries[0].Declared, queries[1].Declared, queries[2].Declared)
+	}
+
+	missing := rec.Missing()
+	if len(missing) != 1 || missing[0].String() != "tasks(deleted,status,-created_at,priority)" {
+		t.Errorf("unexpected missing indexes: %v", missing)
+	}
+	if len(rec.Suggestions()) != 2 {
+		t.Errorf("expected 2 suggestions, got %v", rec.Suggestions())
+	}
+}
+
+func TestIndexRecorder_Where(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	instance, err := RegisterModel(&indexedTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*indexedTask)
+
+	rec := NewIndexRecorder()
+	SetIndexRecorder(rec)
+	defer SetIndexRecorder(nil)
+
+	tasks.recordQuery(nil, nil, queryOptions{
+		where:        []string{`status == "open" and (priority >= 3 or tags contains "urgent")`},
+		whereFilters: []firestore.EntityFilter{firestore.PropertyFilter{Path: "due", Operator: "<", Value: time.Now()}},
+	})
+
+	type shape struct {
+		equality, inequality []string
+		arrayContains        string
+	}
+	var got []shape
+	for _, q := range rec.Queries() {
+		got = append(got, shape{q.Equality, q.Inequality, q.ArrayContains})
+	}
+	expected := []shape{
+		{[]string{"deleted", "status"}, []string{"due", "priority"}, ""},
+		{[]string{"deleted", "status"}, []string{"due"}, "tags"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected one shape per disjunct %+v, got %+v", expected, got)
+	}
+}
+
+func TestIndexRecorder_IncludeDeleted(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	instance, err := RegisterModel(&indexedTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*indexedTask)
+
+	rec := NewIndexRecorder()
+	SetIndexRecorder(rec)
+	defer SetIndexRecorder(nil)
+
+	tasks.recordQuery(map[string]interface{}{"status": "open"}, []SortField{{Field: "created_at"}}, queryOptions{includeDeleted: true})
+	queries := rec.Queries()
+	if len(queries) != 1 || !reflect.DeepEqual(queries[0].Equality, []string{"status"}) {
+		t.Errorf("expected no deleted filter in the shape, got %+v", queries)
+	}
+	if missing := rec.Missing(); len(missing) != 1 || missing[0].String() != "tasks(status,created_at)" {
+		t.Errorf("unexpected missing indexes: %v", missing)
+	}
+}
+
+func TestSetIndexRecorder_Concurrent(t *testing.T) {
+	defer SetIndexRecorder(nil)
+	b := &BaseModel{CollectionName: "tasks"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetIndexRecorder(NewIndexRecorder())
+		}()
+		go func() {
+			defer wg.Done()
+			b.recordQuery(map[string]interface{}{"status": "open"}, nil, queryOptions{})
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Test for collection auditing ---
+
+type auditedTask struct {
+	BaseModel
+	Title    string    `firestore:"title" json:"title" validate:"required"`
+	Priority int       `firestore:"priority" json:"priority"`
+	Due      time.Time `firestore:"due" json:"due"`
+	Tags     []string  `firestore:"tags" json:"tags"`
+}
+
+func TestAuditDocument(t *testing.T) {
+	schema := reflect.TypeOf(auditedTask{})
+	fields := schemaFields(schema)
+	for _, name := range []string{"id", "created_at", "deleted", "title", "priority", "due", "tags"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected schema field '%s'", name)
+		}
+	}
+
+	decodeOK := func(interface{}) error { return nil }
+	decodeErr := func(interface{}) error { return errors.New("cannot decode") }
+
+	tests := []struct {
+		name     string
+		data     map[string]interface{}
+		decode   func(interface{}) error
+		expected []AuditIssueKind
+	}{
+		{
+			name: "valid",
+			data: map[string]interface{}{"title": "a", "priority": int64(2), "due": time.Now(), "tags": []interface{}{"x"}},
+			// The fake decode leaves Title empty, so fill it.
+			decode: func(v interface{}) error {
+				v.(*auditedTask).Title = "a"
+				return nil
+			},
+		},
+		{
+			name:     "unknown field",
+			data:     map[string]interface{}{"title": "a", "legacy": true},
+			decode:   func(v interface{}) error { v.(*auditedTask).Title = "a"; return nil },
+			expected: []AuditIssueKind{UnknownField},
+		},
+		{
+			name:     "type mismatch",
+			data:     map[string]interface{}{"title": "a", "priority": "high", "tags": []interface{}{"x", int64(1)}},
+			decode:   decodeErr,
+			expected: []AuditIssueKind{TypeMismatch, TypeMismatch},
+		},
+		{
+			name:     "missing required",
+			data:     map[string]interface{}{"priority": int64(1)},
+			decode:   decodeOK,
+			expected: []AuditIssueKind{MissingRequired},
+		},
+		{
+			name:     "validation failed",
+			data:     map[string]interface{}{"title": ""},
+			decode:   decodeOK,
+			expected: []AuditIssueKind{ValidationFailed},
+		},
+		{
+			name:     "decode failed",
+			data:     map[string]interface{}{"title": "a"},
+			decode:   decodeErr,
+			expected: []AuditIssueKind{DecodeFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kinds []AuditIssueKind
+			for _, issue := range auditDocument("doc1", tt.data, tt.decode, schema, fields) {
+				if issue.DocumentID != "doc1" {
+					t.Errorf("unexpected document ID %q", issue.DocumentID)
+				}
+				kinds = append(kinds, issue.Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.expected) {
+				t.Errorf("expected issues %v, got %v", tt.expected, kinds)
+			}
+		})
+	}
+}
+
+func TestAssignable(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		target   interface{}
+		expected bool
+	}{
+		{"a", "", true},
+		{int64(1), 0.0, true},
+		{1.5, 0, false},
+		{2.0, 0, true},
+		{time.Now(), time.Time{}, true},
+		{time.Now(), "", false},
+		{map[string]interface{}{}, time.Time{}, false},
+		{map[string]interface{}{}, map[string]int{}, true},
+		{nil, 0, true},
+		{"a", (*string)(nil), true},
+	}
+	for _, tt := range tests {
+		if got := assignable(tt.value, reflect.TypeOf(tt.target)); got != tt.expected {
+			t.Errorf("assignable(%#v, %T): expected %v, got %v", tt.value, tt.target, tt.expected, got)
+		}
+	}
+}
+
+func TestAudit_RequiresModel(t *testing.T) {
+	if _, err := Audit(context.Background(), struct{}{}); err == nil {
+		t.Error("expected error for a value that is not a model, got nil")
+	}
+}
+
+// --- Test for export and import ---
+
+type transferTask struct {
+	BaseModel
+	Title    string            `firestore:"title" json:"title" validate:"required"`
+	Priority int               `firestore:"priority" json:"priority"`
+	Done     bool              `firestore:"done" json:"done"`
+	Tags     []string          `firestore:"tags" json:"tags"`
+	Meta     map[string]string `firestore:"meta" json:"meta,omitempty"`
+	Secret   string            `firestore:"secret" json:"-"`
+}
+
+func TestTransfer_RoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC)
+	deleted := created.Add(time.Hour)
+	original := &transferTask{
+		BaseModel: BaseModel{ID: "t1", CreatedAt: created, UpdatedAt: &deleted, Deleted: true, DeletedAt: &deleted},
+		Title:     "Write, \"quoted\" docs",
+		Priority:  3,
+		Done:      true,
+		Tags:      []string{"a", "b"},
+		Meta:      map[string]string{"k": "v"},
+	}
+	schema := reflect.TypeOf(transferTask{})
+
+	for _, format := range []Format{JSONL, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf strings.Builder
+			var enc recordEncoder = &jsonlEncoder{enc: json.NewEncoder(&buf)}
+			if format == CSV {
+				enc = newCSVEncoder(&buf, schema)
+			}
+			if err := enc.encode(original); err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if err := enc.flush(); err != nil {
+				t.Fatalf("flush failed: %v", err)
+			}
+
+			var dec recordDecoder = &jsonlDecoder{dec: json.NewDecoder(strings.NewReader(buf.String()))}
+			if format == CSV {
+				if !strings.HasPrefix(buf.String(), "id,created_at,updated_at,deleted,deleted_at,title,priority,done,tags,meta\n") {
+					t.Fatalf("unexpected CSV header:\n%s", buf.String())
+				}
+				var err error
+				dec, err = newCSVDecoder(strings.NewReader(buf.String()), schema)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			got := &transferTask{}
+			if err := dec.decode(got); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, original) {
+				t.Errorf("expected %+v, got %+v", original, got)
+			}
+			if err := dec.decode(&transferTask{}); !errors.Is(err, io.EOF) {
+				t.Errorf("expected io.EOF after the last record, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTransfer_CSVErrors(t *testing.T) {
+	schema := reflect.TypeOf(transferTask{})
+	if _, err := newCSVDecoder(strings.NewReader("id,unknown\n"), schema); err == nil {
+		t.Error("expected error for an unknown column, got nil")
+	}
+
+	dec, err := newCSVDecoder(strings.NewReader("id,priority,updated_at\nt1,high,\n"), schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := dec.decode(&transferTask{}); err == nil || !strings.Contains(err.Error(), "column 'priority'") {
+		t.Errorf("expected error for an invalid number, got %v", err)
+	}
+}
+
+func TestTransfer_PrepareImport(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db := &DB{}
+	db.clock.store(fixedClock{now})
+
+	fresh := &transferTask{Title: "new"}
+	if err := prepareImport(reflect.ValueOf(fresh).Elem(), db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fresh.ID == "" || !fresh.CreatedAt.Equal(now) || fresh.UpdatedAt == nil {
+		t.Errorf("expected a new ID and timestamps, got %+v", fresh.BaseModel)
+	}
+
+	created := now.Add(-time.Hour)
+	kept := &transferTask{BaseModel: BaseModel{ID: "t1", CreatedAt: created}}
+	if err := prepareImport(reflect.ValueOf(kept).Elem(), db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if kept.ID != "t1" || !kept.CreatedAt.Equal(created) || !kept.UpdatedAt.Equal(now) {
+		t.Errorf("expected ID and created_at kept, got %+v", kept.BaseModel)
+	}
+
+	if f, err := ParseFormat("CSV"); err != nil || f != CSV {
+		t.Errorf("expected CSV, got %v, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected error for an unsupported format, got nil")
+	}
+	if _, err := Export(context.Background(), struct{}{}, nil, io.Discard, JSONL); err == nil {
+		t.Error("expected error for a value that is not a model, got nil")
+	}
+}
+
+// --- Test for typed errors ---
+
+func TestErrors_Typed(t *testing.T) {
+	var validationErr *ValidationError
+	if err := ValidateStruct(TestStruct{}); !errors.As(err, &validationErr) || validationErr.Field != "Name" {
+		t.Errorf("expected a ValidationError for field Name, got %v", err)
+	}
+	if _, _, _, err := parseFilter("due__gte", "tomorrow"); !errors.As(err, &validationErr) || validationErr.Field != "due__gte" {
+		t.Errorf("expected a ValidationError for the filter, got %v", err)
+	}
+	if _, err := ParseSort("-"); !errors.As(err, &validationErr) {
+		t.Errorf("expected a ValidationError for the sort, got %v", err)
+	}
+
+	if err := notFound("document with ID '%s' has been deleted", "x"); !IsNotFound(err) || err.Error() != "document with ID 'x' has been deleted" {
+		t.Errorf("expected a not found error keeping its message, got %v", err)
+	}
+	if !IsNotFound(status.Error(codes.NotFound, "missing")) || !IsNotFound(fmt.Errorf("wrapped: %w", ErrNotFound)) {
+		t.Error("expected Firestore NotFound and wrapped ErrNotFound to be not found errors")
+	}
+	if IsNotFound(errors.New("boom")) || IsNotFound(nil) {
+		t.Error("expected other errors not to be not found errors")
+	}
+}
+
+// --- Test for list parameters ---
+
+type listTask struct {
+	BaseModel
+	Title    string    `firestore:"title" json:"title"`
+	OwnerID  string    `firestore:"owner_id" json:"ownerId"`
+	Due      time.Time `firestore:"due" json:"dueDate"`
+	Priority int       `firestore:"priority" json:"priority"`
+}
+
+func TestParseListParams(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	model, err := RegisterModel(&listTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+
+	values, _ := url.ParseQuery("ownerId=alice&priority__gte=2&dueDate__lt=2024-01-01&title=a,b&sort=-priority,dueDate&limit=500&cursor=t9&fields=title,ownerId&include_deleted=true")
+	params, err := ParseListParams(values, model)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"owner_id":      "alice",
+		"priority__gte": "2",
+		"due__lt":       "2024-01-01",
+		"title":         []string{"a", "b"},
+	}
+	if !reflect.DeepEqual(params.Filters, expected) {
+		t.Errorf("unexpected filters %v", params.Filters)
+	}
+	if len(params.Sort) != 2 || params.Sort[0].String() != "-priority" || params.Sort[1].String() != "due" {
+		t.Errorf("unexpected sort %v", params.Sort)
+	}
+	if params.Limit != 100 || params.StartAfter != "t9" || !params.IncludeDeleted {
+		t.Errorf("unexpected limit %d, cursor %q or include deleted %v", params.Limit, params.StartAfter, params.IncludeDeleted)
+	}
+	if !reflect.DeepEqual(params.Fields, []string{"title", "owner_id"}) {
+		t.Errorf("unexpected fields %v", params.Fields)
+	}
+	if opts := params.Options(); len(opts) != 3 {
+		t.Errorf("expected sort, select and include deleted options, got %d", len(opts))
+	}
+
+	params, err = ParseListParams(url.Values{"sort": {"title"}, "order": {"desc"}}, model, ListDefaultLimit(5))
+	if err != nil || params.Limit != 5 || params.Sort[0].String() != "-title" || len(params.Filters) != 0 {
+		t.Errorf("unexpected defaults %+v, %v", params, err)
+	}
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{"limit=0", "limit"},
+		{"limit=ten", "limit"},
+		{"cursor=a&start_after=b", "cursor"},
+		{"sort=color", "sort"},
+		{"sort=-", "sort"},
+		{"sort=title,priority&order=asc", "order"},
+		{"sort=title&order=up", "order"},
+		{"fields=title,color", "fields"},
+		{"include_deleted=maybe", "include_deleted"},
+		{"color=red", "color"},
+		{"priority__ne=2", "priority__ne"},
+		{"dueDate__gte=tomorrow", "dueDate__gte"},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		var validationErr *ValidationError
+		if _, err := ParseListParams(values, model); !errors.As(err, &validationErr) || validationErr.Field != tt.field {
+			t.Errorf("%s: expected a ValidationError for %q, got %v", tt.query, tt.field, err)
+		}
+	}
+
+	if _, err := ParseListParams(url.Values{"q": {"text"}}, model, ListIgnore("q")); err != nil {
+		t.Errorf("expected ignored parameters to be skipped, got %v", err)
+	}
+	if _, err := ParseListParams(url.Values{}, &listTask{}); err == nil {
+		t.Error("expected an error for an unregistered model")
+	}
+}
+
+// --- Test for filter expressions ---
+
+func TestParseFilterExpr(t *testing.T) {
+	day := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected firestore.EntityFilter
+	}{
+		{
+			`status in ("open", "blocked") and due_date < 2025-05-01 and (owner == "a" or owner == "b")`,
+			firestore.AndFilter{Filters: []firestore.EntityFilter{
+				firestore.PropertyFilter{Path: "status", Operator: "in", Value: []interface{}{"open", "blocked"}},
+				firestore.PropertyFilter{Path: "due_date", Operator: "<", Value: day.Add(24 * time.Hour)},
+				firestore.OrFilter{Filters: []firestore.EntityFilter{
+					firestore.PropertyFilter{Path: "owner", Operator: "==", Value: "a"},
+					firestore.PropertyFilter{Path: "owner", Operator: "==", Value: "b"},
+				}},
+			}},
+		},
+		{
+			`a = 1 or b >= 2.5 AND c != true`,
+			firestore.OrFilter{Filters: []firestore.EntityFilter{
+				firestore.PropertyFilter{Path: "a", Operator: "==", Value: int64(1)},
+				firestore.AndFilter{Filters: []firestore.EntityFilter{
+					firestore.PropertyFilter{Path: "b", Operator: ">=", Value: 2.5},
+					firestore.PropertyFilter{Path: "c", Operator: "!=", Value: true},
+				}},
+			}},
+		},
+		{
+			`((a <= 2025-05-01)) and (b > 2025-05-01 and meta.tag == open)`,
+			firestore.AndFilter{Filters: []firestore.EntityFilter{
+				firestore.PropertyFilter{Path: "a", Operator: "<=", Value: day.Add(24*time.Hour - time.Nanosecond)},
+				firestore.PropertyFilter{Path: "b", Operator: ">", Value: day},
+				firestore.PropertyFilter{Path: "meta.tag", Operator: "==", Value: "open"},
+			}},
+		},
+		{
+			`tags contains "x" and labels contains any ('a', 'b\'c') and kind not in (1, 2) and parent == null`,
+			firestore.AndFilter{Filters: []firestore.EntityFilter{
+				firestore.PropertyFilter{Path: "tags", Operator: "array-contains", Value: "x"},
+				firestore.PropertyFilter{Path: "labels", Operator: "array-contains-any", Value: []interface{}{"a", "b'c"}},
+				firestore.PropertyFilter{Path: "kind", Operator: "not-in", Value: []interface{}{int64(1), int64(2)}},
+				firestore.PropertyFilter{Path: "parent", Operator: "==", Value: nil},
+			}},
+		},
+		{
+			`at >= 2025-05-01T10:00:00Z`,
+			firestore.PropertyFilter{Path: "at", Operator: ">=", Value: day.Add(10 * time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		filter, err := ParseFilterExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(filter, tt.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tt.expr, tt.expected, filter)
+		}
+	}
+
+	errorTests := []struct {
+		expr  string
+		pos   int
+		token string
+	}{
+		{`status == `, 10, ""},
+		{`status ~ "a"`, 7, "~"},
+		{`status is "a"`, 7, "is"},
+		{`(a == 1`, 7, ""},
+		{`a == 1 b == 2`, 7, "b"},
+		{`a in ("x" "y")`, 10, `"y"`},
+		{`a in "x"`, 5, `"x"`},
+		{`a not "x"`, 6, `"x"`},
+		{`due < tomorrow`, 6, "tomorrow"},
+		{`a == "open`, 5, `"open`},
+		{`a ! 1`, 2, "!"},
+		{`and == 1`, 0, "and"},
+	}
+	for _, tt := range errorTests {
+		_, err := ParseFilterExpr(tt.expr)
+		var exprErr *FilterExprError
+		if !errors.As(err, &exprErr) || exprErr.Pos != tt.pos || exprErr.Token != tt.token {
+			t.Errorf("%s: expected an error at %d near %q, got %#v", tt.expr, tt.pos, tt.token, err)
+		}
+	}
+	_, err := ParseFilterExpr(`due < tomorrow`)
+	if err == nil || err.Error() != "invalid filter expression: invalid value for '<': expected a number or date, quote strings at position 7 near 'tomorrow'" {
+		t.Errorf("unexpected message: %v", err)
+	}
+
+	modelRegistry = NewModelRegistry()
+	model, err := RegisterModel(&listTask{}, "tasks")
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	params, err := ParseListParams(url.Values{"filter": {`ownerId == "a" or dueDate < 2025-05-01`}}, model)
+	expected := firestore.OrFilter{Filters: []firestore.EntityFilter{
+		firestore.PropertyFilter{Path: "owner_id", Operator: "==", Value: "a"},
+		firestore.PropertyFilter{Path: "due", Operator: "<", Value: day.Add(24 * time.Hour)},
+	}}
+	if err != nil || !reflect.DeepEqual(params.Where, expected) || len(params.Options()) != 1 {
+		t.Errorf("unexpected list parameters %+v, %v", params, err)
+	}
+	for _, filter := range []string{`color == "red"`, `ownerId ==`} {
+		var validationErr *ValidationError
+		if _, err := ParseListParams(url.Values{"filter": {filter}}, model); !errors.As(err, &validationErr) || validationErr.Field != "filter" {
+			t.Errorf("%s: expected a ValidationError for the filter, got %v", filter, err)
+		}
+	}
+}
+
+// --- Test for tenant scoping ---
+
+type tenantTask struct {
+	BaseModel
+	TenantID string `firestore:"tenant_id" json:"tenantId"`
+	Title    string `firestore:"title" json:"title" validate:"required"`
+	Priority int    `firestore:"priority" json:"priority"`
+}
+
+func TestTenancy_Registration(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+
+	invalid := map[string][]ModelOption{
+		"unknown field":  {WithTenantField("org")},
+		"json name":      {WithTenantField("tenantId")},
+		"non-string":     {WithTenantField("priority")},
+		"base field":     {WithTenantField("id")},
+		"root path":      {WithTenantPath("tenants/acme")},
+		"empty root":     {WithTenantPath("")},
+		"scoped twice":   {WithTenantPath("tenants"), WithTenantField("tenant_id")},
+		"field and path": {WithTenantField("tenant_id"), WithTenantPath("tenants")},
+	}
+	for name, opts := range invalid {
+		if _, err := RegisterModel(&tenantTask{}, "tasks", opts...); err == nil {
+			t.Errorf("%s: expected a registration error", name)
+			modelRegistry = NewModelRegistry()
+		}
+	}
+
+	if _, err := RegisterModel(&tenantTask{}, "tasks", WithIndex("title", "-priority"), WithTenantField("tenant_id")); err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	indexes := Indexes()
+	if len(indexes) != 1 || indexes[0].String() != "tasks(tenant_id,deleted,title,-priority)" {
+		t.Errorf("expected the index to be scoped by tenant, got %v", indexes)
+	}
+}
+
+func TestTenancy_Path(t *testing.T) {
+	modelRegistry = NewModelRegistry()
+	instance, err := RegisterModel(&tenantTask{}, "orders/{orderID}/items", WithTenantPath("tenants"))
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	items := &instance.(*tenantTask).BaseModel
+
+	if _, err := items.In("o1").collectionPath(context.Background()); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant without a tenant, got %v", err)
+	}
+	ctx := WithTenant(context.Background(), "acme")
+	if path, err := items.In("o1").collectionPath(ctx); err != nil || path != "tenants/acme/orders/o1/items" {
+		t.Errorf("expected the tenant's path, got %q, %v", path, err)
+	}
+	if _, err := items.In("o1").collectionPath(WithTenant(ctx, "a/b")); err == nil {
+		t.Error("expected an error for a tenant ID containing a slash")
+	}
+	if _, err := items.Group().baseQuery(ctx); err == nil {
+		t.Error("expected collection group queries to be rejected")
+	}
+	if id, ok := TenantFromContext(WithTenant(ctx, "")); ok || id != "" {
+		t.Errorf("expected an empty tenant to be no tenant, got %q", id)
+	}
+}
+
+func TestTenancy_Field(t *testing.T) {
+	db := openTestDB(t)
+	instance, err := db.RegisterModel(&tenantTask{}, "tasks", WithTenantField("tenant_id"))
+	if err != nil {
+		t.Fatalf("failed to register model: %v", err)
+	}
+	tasks := instance.(*tenantTask)
+	ctx := WithTenant(context.Background(), "acme")
+
+	if path, err := tasks.collectionPath(ctx); err != nil || path != "tasks" {
+		t.Errorf("expected the shared collection, got %q, %v", path, err)
+	}
+	if err := tasks.Create(context.Background(), &tenantTask{Title: "a"}); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected Create without a tenant to fail with ErrNoTenant, got %v", err)
+	}
+	if _, err := tasks.Count(context.Background(), nil); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected Count without a tenant to fail with ErrNoTenant, got %v", err)
+	}
+
+	doc := &tenantTask{TenantID: "other", Title: "a"}
+	if err := tasks.stampTenant(ctx, reflect.ValueOf(doc).Elem()); err != nil || doc.TenantID != "acme" {
+		t.Errorf("expected the tenant to be stamped, got %q, %v", doc.TenantID, err)
+	}
+	var validationErr *ValidationError
+	if err := tasks.checkTenant(ctx, "t1", map[string]interface{}{"tenant_id": "other"}); !errors.As(err, &validationErr) || validationErr.Field != "tenant_id" {
+		t.Errorf("expected updating the tenant field to be rejected, got %v", err)
+	}
+
+	r := NewIndexRecorder()
+	SetIndexRecorder(r)
+	defer SetIndexRecorder(nil)
+	tasks.recordQuery(map[string]interface{}{"priority__gte": 2}, nil, queryOptions{})
+	if queries := r.Queries(); len(queries) != 1 || !reflect.DeepEqual(queries[0].Equality, []string{"deleted", "tenant_id"}) {
+		t.Errorf("expected the tenant field among the equality filters, got %+v", queries)
+	}
+}
+
+func TestTenancy_Emulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db := openTestDB(t)
+	for _, opt := range []ModelOption{WithTenantField("tenant_id"), WithTenantPath("tenants")} {
+		db.registry().models = make(map[string]ModelInfo)
+		instance, err := db.RegisterModel(&tenantTask{}, "tenant_tasks", opt)
+		if err != nil {
+			t.Fatalf("failed to register model: %v", err)
+		}
+		tasks := instance.(*tenantTask)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		acme, globex := WithTenant(ctx, "acme"), WithTenant(ctx, "globex")
+		doc := &tenantTask{Title: "secret"}
+		if err := tasks.Create(acme, doc); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+
+		if err := tasks.Get(globex, doc.ID, &tenantTask{}); !IsNotFound(err) {
+			t.Errorf("expected another tenant's Get to be not found, got %v", err)
+		}
+		var found []*tenantTask
+		if _, err := tasks.List(globex, nil, 10, "", "", "", &found); err != nil || len(found) != 0 {
+			t.Errorf("expected another tenant's List to be empty, got %d, %v", len(found), err)
+		}
+		if err := tasks.Update(globex, doc.ID, map[string]interface{}{"title": "stolen"}); err == nil {
+			t.Error("expected another tenant's Update to fail")
+		}
+		fetched := &tenantTask{}
+		if err := tasks.Get(acme, doc.ID, fetched); err != nil || fetched.Title != "secret" {
+			t.Errorf("expected the owner to read the document, got %+v, %v", fetched, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,78 @@
+// Package prommetrics exports Firegorm operation metrics to Prometheus.
+//
+//	m, err := prommetrics.New(prometheus.DefaultRegisterer)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	firegorm.SetMetrics(m)
+package prommetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements firegorm.Metrics with Prometheus collectors labeled by
+// collection and operation.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	reads    *prometheus.CounterVec
+	writes   *prometheus.CounterVec
+}
+
+var labels = []string{"collection", "operation"}
+
+// New creates the collectors and registers them with reg, or with
+// prometheus.DefaultRegisterer if reg is nil.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "firegorm_operation_duration_seconds",
+			Help:    "Duration of Firegorm operations.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firegorm_operation_errors_total",
+			Help: "Number of Firegorm operations that returned an error.",
+		}, labels),
+		reads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firegorm_document_reads_total",
+			Help: "Number of Firestore document reads.",
+		}, labels),
+		writes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "firegorm_document_writes_total",
+			Help: "Number of Firestore document writes.",
+		}, labels),
+	}
+
+	for _, c := range []prometheus.Collector{m.duration, m.errors, m.reads, m.writes} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveOperation records the duration of an operation and counts it as an error if err is set.
+func (m *Metrics) ObserveOperation(collection, operation string, duration time.Duration, err error) {
+	m.duration.WithLabelValues(collection, operation).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(collection, operation).Inc()
+	}
+}
+
+// AddReads counts document reads.
+func (m *Metrics) AddReads(collection, operation string, n int) {
+	m.reads.WithLabelValues(collection, operation).Add(float64(n))
+}
+
+// AddWrites counts document writes.
+func (m *Metrics) AddWrites(collection, operation string, n int) {
+	m.writes.WithLabelValues(collection, operation).Add(float64(n))
+}
@@ -0,0 +1,44 @@
+package prommetrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GEMSDEV-mx/firegorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Metrics must satisfy the interface expected by firegorm.SetMetrics.
+var _ firegorm.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.ObserveOperation("tasks", "List", 20*time.Millisecond, nil)
+	m.ObserveOperation("tasks", "List", 30*time.Millisecond, errors.New("boom"))
+	m.AddReads("tasks", "List", 7)
+	m.AddWrites("tasks", "Create", 1)
+
+	if got := testutil.ToFloat64(m.errors.WithLabelValues("tasks", "List")); got != 1 {
+		t.Errorf("expected 1 error, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.reads.WithLabelValues("tasks", "List")); got != 7 {
+		t.Errorf("expected 7 reads, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.writes.WithLabelValues("tasks", "Create")); got != 1 {
+		t.Errorf("expected 1 write, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 1 {
+		t.Errorf("expected 1 duration series, got %d", got)
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Error("expected error when registering the collectors twice, got nil")
+	}
+}
@@ -0,0 +1,313 @@
+package firegorm
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+)
+
+// QueryShape is the structure of a query: the fields it filters and orders
+// by, without their values.
+type QueryShape struct {
+	Model         string
+	Collection    string // Collection ID
+	Group         bool
+	Equality      []string // Fields compared with "==" or "in", sorted
+	Inequality    []string // Fields compared with a range operator, sorted
+	ArrayContains string
+	OrderBy       []SortField
+}
+
+// Index returns the composite index the query needs, or false if single-field
+// indexes are enough.
+func (s QueryShape) Index() (Index, bool) {
+	ix, _, ok := s.index()
+	return ix, ok
+}
+
+// index also returns how many leading fields of the index are equality
+// fields, whose order within the index does not matter.
+func (s QueryShape) index() (Index, int, bool) {
+	ix := Index{Collection: s.Collection, Group: s.Group}
+	seen := make(map[string]bool)
+	for _, field := range s.Equality {
+		ix.Fields = append(ix.Fields, IndexField{Field: field, Direction: firestore.Asc})
+		seen[field] = true
+	}
+	equalities := len(ix.Fields)
+
+	if s.ArrayContains != "" {
+		ix.Fields = append(ix.Fields, IndexField{Field: s.ArrayContains, ArrayContains: true})
+	}
+	for _, clause := range s.OrderBy {
+		if seen[clause.Field] || clause.Field == firestore.DocumentID {
+			continue
+		}
+		ix.Fields = append(ix.Fields, IndexField{Field: clause.Field, Direction: clause.Direction})
+		seen[clause.Field] = true
+	}
+	// Fields compared with a range operator are implicitly ordered ascending.
+	for _, field := range s.Inequality {
+		if !seen[field] {
+			ix.Fields = append(ix.Fields, IndexField{Field: field, Direction: firestore.Asc})
+			seen[field] = true
+		}
+	}
+
+	// Equality-only queries are served by merging single-field indexes.
+	if len(ix.Fields) < 2 || len(ix.Fields) == equalities {
+		return Index{}, 0, false
+	}
+	return ix, equalities, true
+}
+
+// key identifies queries of the same shape.
+func (s QueryShape) key() string {
+	order := make([]string, len(s.OrderBy))
+	for i, clause := range s.OrderBy {
+		order[i] = clause.String()
+	}
+	scope := "collection"
+	if s.Group {
+		scope = "group"
+	}
+	return strings.Join([]string{
+		s.Model, scope, strings.Join(s.Equality, ","), strings.Join(s.Inequality, ","),
+		s.ArrayContains, strings.Join(order, ","),
+	}, "|")
+}
+
+// covers reports whether the declared index can serve a query needing ix,
+// whose first equalities fields may appear in any order.
+func covers(declared, ix Index, equalities int) bool {
+	if declared.Collection != ix.Collection || declared.Group != ix.Group || len(declared.Fields) != len(ix.Fields) {
+		return false
+	}
+	prefix := append([]IndexField(nil), declared.Fields[:equalities]...)
+	wanted := append([]IndexField(nil), ix.Fields[:equalities]...)
+	sortIndexFields(prefix)
+	sortIndexFields(wanted)
+	for i := range wanted {
+		if prefix[i] != wanted[i] {
+			return false
+		}
+	}
+	for i := equalities; i < len(ix.Fields); i++ {
+		if declared.Fields[i] != ix.Fields[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordedQuery is a query shape seen by an IndexRecorder.
+type RecordedQuery struct {
+	QueryShape
+	Count    int  // Number of times the query was issued
+	Declared bool // Whether a declared index covers it, or none is needed
+}
+
+// IndexRecorder captures the shape of every query issued by List, FindOne,
+// Count, Each, Iter and WatchQuery, and suggests the composite indexes they
+// need. It is meant for development and tests: enable it with
+// SetIndexRecorder, exercise the application, then pass Missing to
+// GenerateIndexes.
+type IndexRecorder struct {
+	mu      sync.Mutex
+	queries map[string]*RecordedQuery
+	order   []string
+}
+
+// NewIndexRecorder returns an empty recorder.
+func NewIndexRecorder() *IndexRecorder {
+	return &IndexRecorder{queries: make(map[string]*RecordedQuery)}
+}
+
+// indexRecorder is off unless SetIndexRecorder is called.
+var indexRecorder guarded[*IndexRecorder]
+
+// SetIndexRecorder starts recording query shapes into r. Passing nil stops
+// recording. Queries needing an undeclared composite index are logged as
+// warnings the first time they are seen.
+func SetIndexRecorder(r *IndexRecorder) {
+	indexRecorder.store(r)
+}
+
+// Queries returns the recorded query shapes, in the order first seen.
+func (r *IndexRecorder) Queries() []RecordedQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queries := make([]RecordedQuery, len(r.order))
+	for i, key := range r.order {
+		queries[i] = *r.queries[key]
+	}
+	return queries
+}
+
+// Suggestions returns the composite indexes needed by the recorded queries.
+func (r *IndexRecorder) Suggestions() []Index {
+	return r.indexes(false)
+}
+
+// Missing returns the composite indexes needed by the recorded queries that
+// no model declares.
+func (r *IndexRecorder) Missing() []Index {
+	return r.indexes(true)
+}
+
+func (r *IndexRecorder) indexes(missingOnly bool) []Index {
+	var indexes []Index
+	for _, q := range r.Queries() {
+		if missingOnly && q.Declared {
+			continue
+		}
+		if ix, ok := q.Index(); ok {
+			indexes = append(indexes, ix)
+		}
+	}
+	return dedupIndexes(indexes)
+}
+
+// record counts a query and reports whether it was seen for the first time.
+func (r *IndexRecorder) record(shape QueryShape, declared []Index) (RecordedQuery, bool) {
+	key := shape.key()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if q, ok := r.queries[key]; ok {
+		q.Count++
+		return *q, false
+	}
+
+	q := &RecordedQuery{QueryShape: shape, Count: 1, Declared: true}
+	if ix, equalities, ok := shape.index(); ok {
+		q.Declared = false
+		for _, d := range declared {
+			if covers(d, ix, equalities) {
+				q.Declared = true
+				break
+			}
+		}
+	}
+	r.queries[key] = q
+	r.order = append(r.order, key)
+	return *q, true
+}
+
+// recordQuery records the shape of a query built by this model, if a
+// recorder is set. Queries also filter on deleted == false, unless they
+// include soft-deleted documents. A Where
+// expression with or is recorded as one shape per disjunct, as Firestore
+// serves each of them with its own index.
+func (b *BaseModel) recordQuery(filters map[string]interface{}, clauses []SortField, options queryOptions) {
+	r := indexRecorder.load()
+	if r == nil {
+		return
+	}
+
+	comparisons := make([]firestore.PropertyFilter, 0, len(filters))
+	for key, value := range filters {
+		field, op, _, err := parseFilter(key, value)
+		if err != nil {
+			return
+		}
+		comparisons = append(comparisons, firestore.PropertyFilter{Path: field, Operator: op})
+	}
+	where := firestore.AndFilter{Filters: options.whereFilters}
+	for _, expr := range options.where {
+		filter, err := ParseFilterExpr(expr)
+		if err != nil {
+			return
+		}
+		where.Filters = append(where.Filters, filter)
+	}
+
+	var declared []Index
+	if info, err := b.modelInfo(); err == nil {
+		declared = info.Indexes
+	}
+	for _, conjunction := range conjunctions(where) {
+		shape := b.queryShape(append(slices.Clip(comparisons), conjunction...), clauses, options.includeDeleted)
+		q, first := r.record(shape, declared)
+		if first && !q.Declared {
+			ix, _ := shape.Index()
+			b.log(WARN, "Query on collection '%s' needs a composite index that no model declares: %s", b.CollectionName, ix)
+		}
+	}
+}
+
+// queryShape returns the shape of a query of this model combining the given
+// comparisons, whose values are ignored.
+func (b *BaseModel) queryShape(comparisons []firestore.PropertyFilter, clauses []SortField, includeDeleted bool) QueryShape {
+	shape := QueryShape{
+		Model:      b.CollectionName + "." + b.ModelName,
+		Collection: collectionID(b.CollectionName),
+		Group:      b.group,
+		OrderBy:    clauses,
+	}
+	equality := make(map[string]bool)
+	if !includeDeleted {
+		equality["deleted"] = true
+	}
+	if t := b.tenancy(); t != nil && t.Mode == TenantField {
+		equality[t.Field] = true
+	}
+	inequality := make(map[string]bool)
+	for _, c := range comparisons {
+		switch c.Operator {
+		case "==", "in":
+			equality[c.Path] = true
+		case "array-contains", "array-contains-any":
+			shape.ArrayContains = c.Path
+		default:
+			inequality[c.Path] = true
+		}
+	}
+	shape.Equality = sortedKeys(equality)
+	shape.Inequality = sortedKeys(inequality)
+	return shape
+}
+
+// conjunctions expands a filter into its disjunctive normal form: the
+// comparisons of each disjunct. A filter without or has a single disjunct.
+func conjunctions(filter firestore.EntityFilter) [][]firestore.PropertyFilter {
+	switch f := filter.(type) {
+	case firestore.PropertyFilter:
+		return [][]firestore.PropertyFilter{{f}}
+	case firestore.PropertyPathFilter:
+		return [][]firestore.PropertyFilter{{{Path: strings.Join(f.Path, "."), Operator: f.Operator}}}
+	case firestore.AndFilter:
+		result := [][]firestore.PropertyFilter{nil}
+		for _, child := range f.Filters {
+			var next [][]firestore.PropertyFilter
+			for _, left := range result {
+				for _, right := range conjunctions(child) {
+					next = append(next, append(slices.Clip(left), right...))
+				}
+			}
+			result = next
+		}
+		return result
+	case firestore.OrFilter:
+		var result [][]firestore.PropertyFilter
+		for _, child := range f.Filters {
+			result = append(result, conjunctions(child)...)
+		}
+		return result
+	}
+	return [][]firestore.PropertyFilter{nil}
+}
+
+// sortedKeys returns the keys of m in order. Filter maps are logged and
+// traced through it, so only their keys, never their values, are recorded.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
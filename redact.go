@@ -0,0 +1,188 @@
+package firegorm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redactedText replaces the value of sensitive fields in log output.
+const redactedText = "[REDACTED]"
+
+// maxRedactDepth bounds how deep nested values are walked when logged.
+const maxRedactDepth = 8
+
+// logPayloads controls whether document contents are written to the logs.
+var logPayloads = guarded[bool]{v: true}
+
+// SetLogPayloads controls whether documents, update maps and filter values
+// are written to the logs. When disabled, only document IDs and field names
+// are logged. Fields tagged `firegorm:"sensitive"` or `log:"redact"` are
+// masked either way.
+func SetLogPayloads(on bool) {
+	logPayloads.store(on)
+}
+
+// isSensitiveField reports whether a struct field must never be logged.
+func isSensitiveField(field reflect.StructField) bool {
+	if field.Tag.Get("log") == "redact" {
+		return true
+	}
+	for _, d := range parseFiregormTag(field.Tag.Get("firegorm")) {
+		if d.Name == "sensitive" {
+			return true
+		}
+	}
+	return false
+}
+
+// redacted defers masking a value until it is actually formatted, so
+// filtered-out log entries cost nothing.
+type redacted struct {
+	value interface{}
+	keys  map[string]bool // Sensitive map keys, used for update and filter maps
+}
+
+// redact wraps a model, a slice of models, or an update/filter map for
+// logging. keys lists the sensitive Firestore field names to mask in maps.
+func redact(value interface{}, keys map[string]bool) fmt.Formatter {
+	return redacted{value: value, keys: keys}
+}
+
+func (r redacted) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, fmt.FormatString(f, verb), maskValue(reflect.ValueOf(r.value), r.keys, 0))
+}
+
+// sensitiveKeys returns the sensitive field names of this model, if registered.
+func (b *BaseModel) sensitiveKeys() map[string]bool {
+	info, err := b.modelInfo()
+	if err != nil {
+		return nil
+	}
+	return info.SensitiveFields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func maskValue(v reflect.Value, keys map[string]bool, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxRedactDepth {
+		return "..."
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return maskValue(v.Elem(), keys, depth)
+
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface()
+		}
+		if !logPayloads.load() {
+			if id := v.FieldByName("ID"); id.IsValid() && id.Kind() == reflect.String {
+				return map[string]interface{}{"id": id.String()}
+			}
+			return "[omitted]"
+		}
+		out := make(map[string]interface{})
+		maskStruct(v, out, depth)
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = maskValue(v.Index(i), keys, depth+1)
+		}
+		return out
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			if !logPayloads.load() {
+				return "[omitted]"
+			}
+			return v.Interface()
+		}
+		if !logPayloads.load() {
+			names := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				names = append(names, k.String())
+			}
+			sort.Strings(names)
+			return names
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			// Filter keys carry an operator suffix, e.g. "email__in".
+			field, _, _ := strings.Cut(key, "__")
+			if keys[field] {
+				out[key] = redactedText
+				continue
+			}
+			out[key] = maskValue(iter.Value(), keys, depth+1)
+		}
+		return out
+	}
+
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// maskStruct copies the exported fields of v into out, keyed by their
+// Firestore name, masking sensitive ones and flattening embedded structs.
+func maskStruct(v reflect.Value, out map[string]interface{}, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			maskStruct(v.Field(i), out, depth)
+			continue
+		}
+
+		name := fieldLogName(field)
+		if name == "" {
+			continue
+		}
+		if isSensitiveField(field) {
+			out[name] = redactedText
+			continue
+		}
+		out[name] = maskValue(v.Field(i), nil, depth+1)
+	}
+}
+
+// fieldLogName returns the name a field is logged under, or "" to skip it.
+// Fields excluded from Firestore are skipped unless they hold loaded relations.
+func fieldLogName(field reflect.StructField) string {
+	if name := strings.SplitN(field.Tag.Get("firestore"), ",", 2)[0]; name != "" {
+		if name != "-" {
+			return name
+		}
+		if field.Tag.Get("firegorm") == "" {
+			return ""
+		}
+	}
+	if name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
@@ -3,21 +3,98 @@ package firegorm
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // ModelInfo stores metadata for registered models.
 type ModelInfo struct {
-	CollectionName string
-	Schema         reflect.Type
-	TagToFieldMap  map[string]string // Maps Firestore/JSON tags to field names
+	CollectionName  string
+	Schema          reflect.Type
+	TagToFieldMap   map[string]string   // Maps Firestore/JSON tags to field names
+	ParentParams    []string            // Placeholders of a subcollection path, e.g. ["orderID"]
+	Relations       map[string]Relation // Relation fields keyed by Go field name
+	DefaultSort     []SortField         // Order used when a query does not ask for one
+	SensitiveFields map[string]bool     // Firestore/JSON names of fields masked in logs
+	Indexes         []Index             // Composite indexes declared with tags or WithIndex
+	Tenancy         *Tenancy            // Tenant scoping set with WithTenantPath or WithTenantField
+}
+
+// ModelOption configures a model at registration time.
+type ModelOption func(*ModelInfo) error
+
+// ModelRegistry stores registered models and their metadata, keyed by
+// "collection.TypeName". It is safe for concurrent use.
+type ModelRegistry struct {
+	mu     sync.RWMutex
+	models map[string]ModelInfo
+}
+
+// NewModelRegistry constructs an empty registry.
+func NewModelRegistry() *ModelRegistry {
+	return &ModelRegistry{models: make(map[string]ModelInfo)}
+}
+
+// get returns the metadata of a model.
+func (r *ModelRegistry) get(modelName string) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info, ok := r.models[modelName]
+	return info, ok
+}
+
+// add stores a model unless one is already registered under that name.
+func (r *ModelRegistry) add(modelName string, info ModelInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.models[modelName]; exists {
+		return fmt.Errorf("model '%s' is already registered", modelName)
+	}
+	r.models[modelName] = info
+	return nil
+}
+
+// remove deletes a model and reports whether it was registered.
+func (r *ModelRegistry) remove(modelName string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exists := r.models[modelName]
+	delete(r.models, modelName)
+	return exists
+}
+
+// names returns the registered model names in sorted order.
+func (r *ModelRegistry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.models))
+	for name := range r.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Registry to store models and their metadata.
-var modelRegistry = make(map[string]ModelInfo)
+var modelRegistry = NewModelRegistry()
+
+// RegisterModel registers a model with the default DB.
+// The collection name may be a subcollection path template such as
+// "orders/{orderID}/items"; bind the parent IDs with In before using it.
+func RegisterModel(model interface{}, collectionName string, opts ...ModelOption) (interface{}, error) {
+	return defaultDB.RegisterModel(model, collectionName, opts...)
+}
+
+// RegisterModel registers a model with its collection name and schema. The
+// returned instance reads and writes through this DB.
+func (db *DB) RegisterModel(model interface{}, collectionName string, opts ...ModelOption) (interface{}, error) {
+	parentParams, err := parseCollectionTemplate(collectionName)
+	if err != nil {
+		db.Log(ERROR, "RegisterModel failed: %v", err)
+		return nil, err
+	}
 
-// RegisterModel registers a model with its collection name and schema.
-func RegisterModel(model interface{}, collectionName string) (interface{}, error) {
 	modelType := reflect.TypeOf(model)
 	if modelType.Kind() == reflect.Ptr {
 		modelType = modelType.Elem()
@@ -25,16 +102,29 @@ func RegisterModel(model interface{}, collectionName string) (interface{}, error
 
 	modelName := collectionName + "." + modelType.Name()
 
-	if _, exists := modelRegistry[modelName]; exists {
-		Log(WARN, "Model '%s' is already registered", modelName)
+	models := db.registry()
+	if _, exists := models.get(modelName); exists {
+		db.Log(WARN, "Model '%s' is already registered", modelName)
 		return nil, fmt.Errorf("model '%s' is already registered", modelName)
 	}
 
 	// Build tag-to-field mapping
     tagToFieldMap := make(map[string]string)
+    relations := make(map[string]Relation)
+    sensitiveFields := make(map[string]bool)
     for i := 0; i < modelType.NumField(); i++ {
         field := modelType.Field(i)
 
+        rel, err := parseRelation(field)
+        if err != nil {
+            db.Log(ERROR, "RegisterModel failed: %v", err)
+            return nil, err
+        }
+        if rel != nil {
+            relations[field.Name] = *rel
+            continue
+        }
+
         // strip options from firestore tag
         rawFS := field.Tag.Get("firestore")
         if rawFS != "" && rawFS != "-" {
@@ -52,14 +142,45 @@ func RegisterModel(model interface{}, collectionName string) (interface{}, error
                 tagToFieldMap[name] = field.Name
             }
         }
+
+        if isSensitiveField(field) {
+            for name, fieldName := range tagToFieldMap {
+                if fieldName == field.Name {
+                    sensitiveFields[name] = true
+                }
+            }
+        }
     }
 
-	modelRegistry[modelName] = ModelInfo{
-		CollectionName: collectionName,
-		Schema:         modelType,
-		TagToFieldMap:  tagToFieldMap,
+	indexes, err := parseIndexTags(modelType, collectionName)
+	if err != nil {
+		db.Log(ERROR, "RegisterModel failed: %v", err)
+		return nil, err
+	}
+
+	info := ModelInfo{
+		CollectionName:  collectionName,
+		Schema:          modelType,
+		TagToFieldMap:   tagToFieldMap,
+		ParentParams:    parentParams,
+		Relations:       relations,
+		SensitiveFields: sensitiveFields,
+		Indexes:         indexes,
+	}
+	for _, opt := range opts {
+		if err := opt(&info); err != nil {
+			db.Log(ERROR, "RegisterModel failed for model '%s': %v", modelName, err)
+			return nil, err
+		}
 	}
-	Log(INFO, "Registered model '%s' with collection '%s': %+v", modelName, collectionName, modelRegistry)
+	info.Indexes = info.Tenancy.scopeIndexes(info.Indexes)
+
+	// Another goroutine may have registered the same model in the meantime.
+	if err := models.add(modelName, info); err != nil {
+		db.Log(WARN, "Model '%s' is already registered", modelName)
+		return nil, err
+	}
+	db.Log(INFO, "Registered model '%s' with collection '%s': %+v", modelName, collectionName, info)
 
 	// Initialize the model instance
 	instance := reflect.New(modelType).Interface()
@@ -69,21 +190,113 @@ func RegisterModel(model interface{}, collectionName string) (interface{}, error
 		SetCollectionName(string)
 		SetModelName(string)
 	}); ok {
+		if bound, ok := instance.(interface{ setDB(*DB) }); ok {
+			bound.setDB(db)
+		}
 		baseModel.SetCollectionName(collectionName)
 		baseModel.SetModelName(modelType.Name())
-		Log(DEBUG, "Initialized model instance with collection '%s' and name '%s'", collectionName, modelType.Name())
+		db.Log(DEBUG, "Initialized model instance with collection '%s' and name '%s'", collectionName, modelType.Name())
 	}
 
 	return instance, nil
 }
 
-// GetModelInfo retrieves metadata for a registered model.
+// GetModelInfo retrieves metadata for a model registered with the default DB.
 func GetModelInfo(modelName string) (ModelInfo, error) {
-	info, exists := modelRegistry[modelName]
+	return defaultDB.GetModelInfo(modelName)
+}
+
+// GetModelInfo retrieves metadata for a registered model.
+func (db *DB) GetModelInfo(modelName string) (ModelInfo, error) {
+	info, exists := db.registry().get(modelName)
 	if !exists {
-		Log(WARN, "Model '%s' is not registered. Current registry: %+v", modelName, modelRegistry)
+		db.Log(WARN, "Model '%s' is not registered. Registered models: %v", modelName, db.registry().names())
 		return ModelInfo{}, fmt.Errorf("model '%s' is not registered", modelName)
 	}
-	Log(DEBUG, "Retrieved model info for '%s': %+v", modelName, info)
+	db.Log(DEBUG, "Retrieved model info for '%s': %+v", modelName, info)
 	return info, nil
 }
+
+// Model returns a handle for a model registered with the default DB.
+func Model(modelName string) (*BaseModel, error) {
+	return defaultDB.Model(modelName)
+}
+
+// Model returns a handle for a registered model, for tools that work with
+// models by name. Results are decoded into values of ModelInfo.Schema.
+func (db *DB) Model(modelName string) (*BaseModel, error) {
+	info, err := db.GetModelInfo(modelName)
+	if err != nil {
+		return nil, err
+	}
+	return &BaseModel{CollectionName: info.CollectionName, ModelName: info.Schema.Name(), db: db}, nil
+}
+
+// ListModels returns the names of the models registered with the default DB.
+func ListModels() []string {
+	return defaultDB.ListModels()
+}
+
+// ListModels returns the names of the registered models, in the
+// "collection.TypeName" form accepted by GetModelInfo and Unregister.
+func (db *DB) ListModels() []string {
+	return db.registry().names()
+}
+
+// ModelFor looks up a model registered with the default DB by its Go type.
+func ModelFor(model interface{}) (ModelInfo, error) {
+	return defaultDB.ModelFor(model)
+}
+
+// ModelFor looks up a registered model by its Go type. model may be a
+// reflect.Type, a value or a pointer of the model type. It fails if the type
+// is not registered or is registered with more than one collection.
+func (db *DB) ModelFor(model interface{}) (ModelInfo, error) {
+	modelType, ok := model.(reflect.Type)
+	if !ok {
+		modelType = reflect.TypeOf(model)
+	}
+	if modelType == nil {
+		return ModelInfo{}, fmt.Errorf("model type must not be nil")
+	}
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	models := db.registry()
+	var found []ModelInfo
+	for _, name := range models.names() {
+		if info, ok := models.get(name); ok && info.Schema == modelType {
+			found = append(found, info)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		db.Log(WARN, "Model type '%s' is not registered", modelType)
+		return ModelInfo{}, fmt.Errorf("model type '%s' is not registered", modelType)
+	case 1:
+		return found[0], nil
+	}
+	collections := make([]string, len(found))
+	for i, info := range found {
+		collections[i] = info.CollectionName
+	}
+	return ModelInfo{}, fmt.Errorf("model type '%s' is registered with several collections: %s", modelType, strings.Join(collections, ", "))
+}
+
+// Unregister removes a model from the default DB.
+func Unregister(modelName string) error {
+	return defaultDB.Unregister(modelName)
+}
+
+// Unregister removes a registered model. Instances returned by RegisterModel
+// stop working until the model is registered again.
+func (db *DB) Unregister(modelName string) error {
+	if !db.registry().remove(modelName) {
+		db.Log(WARN, "Model '%s' is not registered", modelName)
+		return fmt.Errorf("model '%s' is not registered", modelName)
+	}
+	db.Log(INFO, "Unregistered model '%s'", modelName)
+	return nil
+}
@@ -0,0 +1,262 @@
+package firegorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// RelationKind identifies how a related model is linked.
+type RelationKind string
+
+const (
+	// BelongsTo links to a single document whose ID is stored in a field of this model.
+	BelongsTo RelationKind = "belongs_to"
+	// HasMany links to every document of another collection whose foreign key holds this model's ID.
+	HasMany RelationKind = "has_many"
+)
+
+// maxInValues is the Firestore limit of values in an "in" filter.
+const maxInValues = 30
+
+// Relation describes a relation field declared with a `firegorm` struct tag.
+type Relation struct {
+	Kind       RelationKind
+	Field      string // Go field that receives the related model(s)
+	Collection string // Collection of the related documents
+	ForeignKey string // Firestore field holding the foreign ID
+}
+
+// parseRelation builds the relation declared on a struct field, if any.
+func parseRelation(field reflect.StructField) (*Relation, error) {
+	for _, d := range parseFiregormTag(field.Tag.Get("firegorm")) {
+		kind := RelationKind(d.Name)
+		if kind != BelongsTo && kind != HasMany {
+			continue
+		}
+
+		rel := &Relation{
+			Kind:       kind,
+			Field:      field.Name,
+			Collection: d.Value,
+			ForeignKey: d.Options["fk"],
+		}
+		if rel.Collection == "" || rel.ForeignKey == "" {
+			return nil, fmt.Errorf("relation field '%s' must declare a collection and fk, e.g. %s:users,fk=user_id", field.Name, kind)
+		}
+		if name := field.Tag.Get("firestore"); name != "-" {
+			return nil, fmt.Errorf("relation field '%s' must be tagged firestore:\"-\" so it is not persisted", field.Name)
+		}
+
+		target := field.Type
+		if kind == HasMany {
+			if target.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("has_many field '%s' must be a slice", field.Name)
+			}
+			target = target.Elem()
+		}
+		if target.Kind() == reflect.Ptr {
+			target = target.Elem()
+		}
+		if target.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("relation field '%s' must refer to a struct type", field.Name)
+		}
+		return rel, nil
+	}
+	return nil, nil
+}
+
+// preload fills the requested relation fields of items, which must be
+// addressable struct values of the model's schema.
+func (b *BaseModel) preload(ctx context.Context, items []reflect.Value, names []string) error {
+	if len(names) == 0 || len(items) == 0 {
+		return nil
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		rel, ok := info.Relations[name]
+		if !ok {
+			return fmt.Errorf("model '%s' has no relation '%s'", b.ModelName, name)
+		}
+
+		switch rel.Kind {
+		case BelongsTo:
+			err = preloadBelongsTo(ctx, b.database(), info, rel, items)
+		case HasMany:
+			err = preloadHasMany(ctx, b.database(), rel, items)
+		}
+		if err != nil {
+			b.logf(ctx, ERROR, "Failed to preload '%s' for model '%s': %v", name, b.ModelName, err)
+			return err
+		}
+		b.logf(ctx, DEBUG, "Preloaded relation '%s' for %d document(s) of model '%s'", name, len(items), b.ModelName)
+	}
+	return nil
+}
+
+// preloadBelongsTo batch-fetches the referenced documents with a single GetAll.
+func preloadBelongsTo(ctx context.Context, db *DB, info ModelInfo, rel Relation, items []reflect.Value) error {
+	fkField, ok := info.TagToFieldMap[rel.ForeignKey]
+	if !ok {
+		return fmt.Errorf("foreign key '%s' of relation '%s' does not exist in the model", rel.ForeignKey, rel.Field)
+	}
+
+	tenancy := db.tenancyOf(rel.Collection)
+	path, err := tenancy.scopePath(ctx, rel.Collection)
+	if err != nil {
+		return err
+	}
+	col := db.Client().Collection(path)
+	var refs []*firestore.DocumentRef
+	seen := make(map[string]bool)
+	for _, item := range items {
+		id := item.FieldByName(fkField).String()
+		if id != "" && !seen[id] {
+			seen[id] = true
+			refs = append(refs, col.Doc(id))
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	docs, err := db.Client().GetAll(ctx, refs)
+	addReads(ctx, len(refs))
+	if err != nil {
+		return err
+	}
+
+	fieldType := items[0].FieldByName(rel.Field).Type()
+	related := make(map[string]reflect.Value, len(docs))
+	for _, doc := range docs {
+		if !doc.Exists() || isSoftDeleted(doc) || !tenancy.owns(ctx, doc) {
+			continue
+		}
+		value, err := decodeDocument(doc, fieldType)
+		if err != nil {
+			return err
+		}
+		related[doc.Ref.ID] = value
+	}
+
+	for _, item := range items {
+		if value, ok := related[item.FieldByName(fkField).String()]; ok {
+			item.FieldByName(rel.Field).Set(value)
+		}
+	}
+	return nil
+}
+
+// preloadHasMany fetches the related documents with "in" queries on the
+// foreign key, chunked to the Firestore limit, and groups them by parent.
+func preloadHasMany(ctx context.Context, db *DB, rel Relation, items []reflect.Value) error {
+	var ids []string
+	byID := make(map[string][]reflect.Value)
+	for _, item := range items {
+		id := item.FieldByName("ID").String()
+		if id == "" {
+			continue
+		}
+		if _, ok := byID[id]; !ok {
+			ids = append(ids, id)
+		}
+		byID[id] = append(byID[id], item)
+	}
+
+	sliceType := items[0].FieldByName(rel.Field).Type()
+	children := make(map[string]reflect.Value)
+
+	tenancy := db.tenancyOf(rel.Collection)
+	path, err := tenancy.scopePath(ctx, rel.Collection)
+	if err != nil {
+		return err
+	}
+	query, err := tenancy.scopeQuery(ctx, db.Client().Collection(path).Query, rel.Collection)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(ids); start += maxInValues {
+		end := start + maxInValues
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		iter := query.
+			Where(rel.ForeignKey, "in", ids[start:end]).
+			Where("deleted", "==", false).
+			Documents(ctx)
+
+		fetched := 0
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return err
+			}
+
+			parentID, _ := doc.Data()[rel.ForeignKey].(string)
+			value, err := decodeDocument(doc, sliceType.Elem())
+			if err != nil {
+				iter.Stop()
+				return err
+			}
+			list, ok := children[parentID]
+			if !ok {
+				list = reflect.MakeSlice(sliceType, 0, 1)
+			}
+			children[parentID] = reflect.Append(list, value)
+			fetched++
+		}
+		iter.Stop()
+		addReads(ctx, max(fetched, 1))
+	}
+
+	for id, parents := range byID {
+		list, ok := children[id]
+		if !ok {
+			list = reflect.MakeSlice(sliceType, 0, 0)
+		}
+		for _, item := range parents {
+			item.FieldByName(rel.Field).Set(list)
+		}
+	}
+	return nil
+}
+
+// decodeDocument maps a document onto a new value of target, which is either
+// a struct type or a pointer to one.
+func decodeDocument(doc *firestore.DocumentSnapshot, target reflect.Type) (reflect.Value, error) {
+	structType := target
+	if target.Kind() == reflect.Ptr {
+		structType = target.Elem()
+	}
+
+	ptr := reflect.New(structType)
+	if err := doc.DataTo(ptr.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to map document '%s': %v", doc.Ref.ID, err)
+	}
+	if target.Kind() == reflect.Ptr {
+		return ptr, nil
+	}
+	return ptr.Elem(), nil
+}
+
+// structValue returns the addressable struct behind a model pointer or slice element.
+func structValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,432 @@
+// Package rest exposes registered firegorm models over HTTP as JSON.
+//
+//	inst, _ := firegorm.RegisterModel(&Task{}, "tasks")
+//	mux.Handle("/tasks/", http.StripPrefix("/tasks", rest.Handler(inst.(*Task), rest.Options{})))
+//
+// The handler serves:
+//
+//	GET    /        list, with the query parameters of firegorm.ParseListParams
+//	POST   /        create
+//	GET    /{id}    get
+//	PATCH  /{id}    update the fields in the body
+//	DELETE /{id}    soft delete
+//
+// Bodies and responses use the model's json tags. Validation errors are
+// answered with 400, missing and soft-deleted documents with 404.
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/GEMSDEV-mx/firegorm"
+)
+
+// Model is the part of a firegorm model the handler uses. The values
+// returned by firegorm.RegisterModel, and handles derived from them with In,
+// implement it.
+type Model interface {
+	Create(ctx context.Context, data interface{}) error
+	Get(ctx context.Context, id string, model interface{}, opts ...firegorm.QueryOption) error
+	List(ctx context.Context, filters map[string]interface{}, limit int, startAfter string, sortField string, sortOrder string, results interface{}, opts ...firegorm.QueryOption) (string, error)
+	Update(ctx context.Context, id string, updates map[string]interface{}) error
+	Delete(ctx context.Context, id string) error
+	GetModelInfo() (firegorm.ModelInfo, error)
+}
+
+// Action is an operation of the handler.
+type Action string
+
+const (
+	ActionList   Action = "list"
+	ActionGet    Action = "get"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Options configures Handler.
+type Options struct {
+	// Actions limits the operations served; all of them when empty. Other
+	// requests are answered with 405.
+	Actions []Action
+
+	// DefaultLimit is the page size of list requests without a limit
+	// parameter (20 by default). MaxLimit caps the limit parameter (100 by default).
+	DefaultLimit int
+	MaxLimit     int
+
+	// Authorize runs before every operation; id is empty for list and
+	// create. A non-nil error rejects the request, with its status if it is
+	// an *Error and 403 otherwise.
+	Authorize func(r *http.Request, action Action, id string) error
+
+	// AllowIncludeDeleted lets list requests return soft-deleted documents
+	// with include_deleted=true.
+	AllowIncludeDeleted bool
+
+	// Scope adds filters to every list request, e.g. to restrict the results
+	// to the caller's documents. Errors are handled as for Authorize.
+	Scope func(r *http.Request, filters map[string]interface{}) error
+
+	// AuthorizeDocument runs on the stored document before it is returned,
+	// updated or deleted. Errors are handled as for Authorize.
+	AuthorizeDocument func(r *http.Request, action Action, doc interface{}) error
+}
+
+// Error is an error with an HTTP status, for the authorization hooks.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// maxBodySize is the largest request body accepted, the size limit of a
+// Firestore document.
+const maxBodySize = 1 << 20
+
+// readOnlyFields are the BaseModel fields clients cannot update.
+var readOnlyFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted":    true,
+	"deleted_at": true,
+}
+
+// field is a model field addressed by its json name.
+type field struct {
+	firestore string
+	typ       reflect.Type
+}
+
+type handler struct {
+	model   Model
+	schema  reflect.Type
+	fields  map[string]field // Keyed by json name
+	actions map[Action]bool
+	opts    Options
+}
+
+// Handler returns an http.Handler serving the model. It panics if the model
+// is not registered, as that is a programming error.
+func Handler(model Model, opts Options) http.Handler {
+	info, err := model.GetModelInfo()
+	if err != nil {
+		panic(fmt.Sprintf("rest: %v", err))
+	}
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = 20
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = 100
+	}
+
+	h := &handler{
+		model:   model,
+		schema:  info.Schema,
+		fields:  make(map[string]field),
+		actions: make(map[Action]bool),
+		opts:    opts,
+	}
+	collectFields(info.Schema, h.fields)
+
+	actions := opts.Actions
+	if len(actions) == 0 {
+		actions = []Action{ActionList, ActionGet, ActionCreate, ActionUpdate, ActionDelete}
+	}
+	for _, action := range actions {
+		h.actions[action] = true
+	}
+	return h
+}
+
+// collectFields maps the json names of the persisted fields of t to their
+// Firestore names, flattening embedded structs.
+func collectFields(t reflect.Type, fields map[string]field) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		jsonName := tagName(f.Tag.Get("json"))
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && jsonName == "" {
+			collectFields(f.Type, fields)
+			continue
+		}
+		storeName := tagName(f.Tag.Get("firestore"))
+		if f.PkgPath != "" || jsonName == "-" || storeName == "-" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		if storeName == "" {
+			storeName = f.Name
+		}
+		fields[jsonName] = field{firestore: storeName, typ: f.Type}
+	}
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(r.URL.Path, "/")
+	if strings.Contains(id, "/") {
+		writeError(w, &Error{Status: http.StatusNotFound, Message: "not found"})
+		return
+	}
+
+	var action Action
+	var allow []string
+	if id == "" {
+		allow = h.allowed(map[string]Action{http.MethodGet: ActionList, http.MethodPost: ActionCreate})
+		switch r.Method {
+		case http.MethodGet:
+			action = ActionList
+		case http.MethodPost:
+			action = ActionCreate
+		}
+	} else {
+		allow = h.allowed(map[string]Action{http.MethodGet: ActionGet, http.MethodPatch: ActionUpdate, http.MethodDelete: ActionDelete})
+		switch r.Method {
+		case http.MethodGet:
+			action = ActionGet
+		case http.MethodPatch:
+			action = ActionUpdate
+		case http.MethodDelete:
+			action = ActionDelete
+		}
+	}
+	if action == "" || !h.actions[action] {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, &Error{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r, action, id); err != nil {
+			writeError(w, forbidden(err))
+			return
+		}
+	}
+
+	var err error
+	switch action {
+	case ActionList:
+		err = h.list(w, r)
+	case ActionCreate:
+		err = h.create(w, r)
+	case ActionGet:
+		err = h.get(w, r, id)
+	case ActionUpdate:
+		err = h.update(w, r, id)
+	case ActionDelete:
+		err = h.delete(w, r, id)
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// allowed returns the methods of an endpoint whose actions are enabled.
+func (h *handler) allowed(methods map[string]Action) []string {
+	var allow []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		if action, ok := methods[method]; ok && h.actions[action] {
+			allow = append(allow, method)
+		}
+	}
+	return allow
+}
+
+// listResponse is the body of a list response.
+type listResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) error {
+	params, err := firegorm.ParseListParams(r.URL.Query(), h.model,
+		firegorm.ListDefaultLimit(h.opts.DefaultLimit), firegorm.ListMaxLimit(h.opts.MaxLimit))
+	if err != nil {
+		return err
+	}
+	if params.IncludeDeleted && !h.opts.AllowIncludeDeleted {
+		return &firegorm.ValidationError{Field: "include_deleted", Message: "include_deleted is not allowed"}
+	}
+	if h.opts.Scope != nil {
+		if err := h.opts.Scope(r, params.Filters); err != nil {
+			return forbidden(err)
+		}
+	}
+
+	results := reflect.New(reflect.SliceOf(reflect.PointerTo(h.schema)))
+	results.Elem().Set(reflect.MakeSlice(results.Elem().Type(), 0, params.Limit))
+	next, err := h.model.List(r.Context(), params.Filters, params.Limit, params.StartAfter, "", "", results.Interface(), params.Options()...)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, listResponse{Items: results.Elem().Interface(), NextCursor: next})
+	return nil
+}
+
+func (h *handler) create(w http.ResponseWriter, r *http.Request) error {
+	item := reflect.New(h.schema).Interface()
+	if err := decodeBody(w, r, item); err != nil {
+		return err
+	}
+	if err := h.model.Create(r.Context(), item); err != nil {
+		return err
+	}
+
+	id := reflect.ValueOf(item).Elem().FieldByName("ID").String()
+	if u, err := url.Parse(r.RequestURI); err == nil && id != "" {
+		w.Header().Set("Location", path.Join(u.Path, url.PathEscape(id)))
+	}
+	writeJSON(w, http.StatusCreated, item)
+	return nil
+}
+
+// load fetches a document and runs AuthorizeDocument on it.
+func (h *handler) load(r *http.Request, action Action, id string) (interface{}, error) {
+	item := reflect.New(h.schema).Interface()
+	if err := h.model.Get(r.Context(), id, item); err != nil {
+		return nil, err
+	}
+	if h.opts.AuthorizeDocument != nil {
+		if err := h.opts.AuthorizeDocument(r, action, item); err != nil {
+			return nil, forbidden(err)
+		}
+	}
+	return item, nil
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request, id string) error {
+	item, err := h.load(r, ActionGet, id)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, item)
+	return nil
+}
+
+func (h *handler) update(w http.ResponseWriter, r *http.Request, id string) error {
+	var body map[string]json.RawMessage
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return &firegorm.ValidationError{Message: "request body has no fields to update"}
+	}
+
+	updates := make(map[string]interface{}, len(body))
+	for name, raw := range body {
+		f, ok := h.fields[name]
+		switch {
+		case !ok:
+			return &firegorm.ValidationError{Field: name, Message: fmt.Sprintf("unknown field '%s'", name)}
+		case readOnlyFields[f.firestore]:
+			return &firegorm.ValidationError{Field: name, Message: fmt.Sprintf("field '%s' cannot be updated", name)}
+		}
+		value := reflect.New(f.typ)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return &firegorm.ValidationError{Field: name, Message: fmt.Sprintf("invalid value for field '%s': expected %s", name, f.typ)}
+		}
+		updates[f.firestore] = value.Elem().Interface()
+	}
+
+	if _, err := h.load(r, ActionUpdate, id); err != nil {
+		return err
+	}
+	if err := h.model.Update(r.Context(), id, updates); err != nil {
+		return err
+	}
+	item := reflect.New(h.schema).Interface()
+	if err := h.model.Get(r.Context(), id, item); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, item)
+	return nil
+}
+
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, id string) error {
+	if _, err := h.load(r, ActionDelete, id); err != nil {
+		return err
+	}
+	if err := h.model.Delete(r.Context(), id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// decodeBody reads a JSON request body into v, rejecting unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			return &Error{Status: http.StatusRequestEntityTooLarge, Message: "request body too large"}
+		case errors.Is(err, io.EOF):
+			return &Error{Status: http.StatusBadRequest, Message: "request body is empty"}
+		}
+		return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid request body: %v", err)}
+	}
+	if dec.More() {
+		return &Error{Status: http.StatusBadRequest, Message: "invalid request body: unexpected data after the JSON value"}
+	}
+	return nil
+}
+
+// forbidden gives errors of the authorization hooks a status.
+func forbidden(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Status: http.StatusForbidden, Message: err.Error()}
+}
+
+// errorResponse is the body of an error response.
+type errorResponse struct {
+	Error string `json:"error"`
+	Field string `json:"field,omitempty"`
+}
+
+// writeError answers with the status matching err. Unexpected errors are
+// logged and answered with 500 without details.
+func writeError(w http.ResponseWriter, err error) {
+	var restErr *Error
+	var validationErr *firegorm.ValidationError
+	switch {
+	case errors.As(err, &restErr):
+		writeJSON(w, restErr.Status, errorResponse{Error: restErr.Message})
+	case errors.As(err, &validationErr):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: validationErr.Message, Field: validationErr.Field})
+	case firegorm.IsNotFound(err):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+	default:
+		firegorm.Log(firegorm.ERROR, "REST request failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal server error"})
+	}
+}
+
+// writeJSON writes a response. Encoding errors are not reported: the
+// status has been sent and the client is most likely gone.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
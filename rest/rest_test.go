@@ -0,0 +1,232 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GEMSDEV-mx/firegorm"
+)
+
+type task struct {
+	firegorm.BaseModel
+	Title    string `firestore:"title" json:"title" validate:"required"`
+	Priority int    `firestore:"priority" json:"priority"`
+	OwnerID  string `firestore:"owner_id" json:"ownerId"`
+}
+
+// memModel is an in-memory Model recording the calls it receives.
+type memModel struct {
+	docs    map[string]*task
+	filters map[string]interface{}
+	opts    int
+	limit   int
+	updates map[string]interface{}
+}
+
+func newMemModel() *memModel {
+	return &memModel{docs: map[string]*task{
+		"t1": {BaseModel: firegorm.BaseModel{ID: "t1"}, Title: "First", Priority: 1, OwnerID: "alice"},
+		"t2": {BaseModel: firegorm.BaseModel{ID: "t2", Deleted: true}, Title: "Gone", OwnerID: "alice"},
+	}}
+}
+
+func (m *memModel) Create(ctx context.Context, data interface{}) error {
+	if err := firegorm.ValidateStruct(data); err != nil {
+		return err
+	}
+	t := data.(*task)
+	t.ID = fmt.Sprintf("t%d", len(m.docs)+1)
+	m.docs[t.ID] = t
+	return nil
+}
+
+func (m *memModel) Get(ctx context.Context, id string, model interface{}, opts ...firegorm.QueryOption) error {
+	t, ok := m.docs[id]
+	if !ok || t.Deleted {
+		return firegorm.ErrNotFound
+	}
+	*model.(*task) = *t
+	return nil
+}
+
+func (m *memModel) List(ctx context.Context, filters map[string]interface{}, limit int, startAfter string, sortField string, sortOrder string, results interface{}, opts ...firegorm.QueryOption) (string, error) {
+	m.filters, m.opts, m.limit = filters, len(opts), limit
+	list := results.(*[]*task)
+	*list = append(*list, m.docs["t1"])
+	return "t1", nil
+}
+
+func (m *memModel) Update(ctx context.Context, id string, updates map[string]interface{}) error {
+	m.updates = updates
+	if title, ok := updates["title"].(string); ok {
+		m.docs[id].Title = title
+	}
+	return nil
+}
+
+func (m *memModel) Delete(ctx context.Context, id string) error {
+	m.docs[id].Deleted = true
+	return nil
+}
+
+func (m *memModel) GetModelInfo() (firegorm.ModelInfo, error) {
+	return firegorm.ModelInfo{
+		CollectionName: "tasks",
+		Schema:         reflect.TypeOf(task{}),
+		TagToFieldMap:  map[string]string{"title": "Title", "priority": "Priority", "owner_id": "OwnerID", "ownerId": "OwnerID"},
+	}, nil
+}
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_CRUD(t *testing.T) {
+	m := newMemModel()
+	h := Handler(m, Options{MaxLimit: 50})
+
+	rec := serve(h, http.MethodGet, "/t1", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ownerId":"alice"`) {
+		t.Errorf("get: unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(h, http.MethodGet, "/t2", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted: expected 404, got %d", rec.Code)
+	}
+
+	rec = serve(h, http.MethodGet, "/?ownerId=alice&priority__gte=2&sort=-priority&limit=500&cursor=t0", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: unexpected response %d %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Items      []task `json:"items"`
+		NextCursor string `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("list: invalid body: %v", err)
+	}
+	if len(page.Items) != 1 || page.NextCursor != "t1" {
+		t.Errorf("list: unexpected page %+v", page)
+	}
+	expected := map[string]interface{}{"owner_id": "alice", "priority__gte": "2"}
+	if !reflect.DeepEqual(m.filters, expected) || m.opts != 1 || m.limit != 50 {
+		t.Errorf("list: unexpected query filters=%v options=%d limit=%d", m.filters, m.opts, m.limit)
+	}
+
+	rec = serve(h, http.MethodPost, "/", `{"title":"New","priority":3}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/t3" {
+		t.Errorf("create: unexpected response %d %s, location %q", rec.Code, rec.Body, rec.Header().Get("Location"))
+	}
+
+	rec = serve(h, http.MethodPatch, "/t1", `{"title":"Renamed","priority":5}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"title":"Renamed"`) {
+		t.Errorf("update: unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if m.updates["priority"] != 5 {
+		t.Errorf("update: expected priority decoded as int, got %#v", m.updates["priority"])
+	}
+
+	if rec := serve(h, http.MethodDelete, "/t1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", rec.Code)
+	}
+	if rec := serve(h, http.MethodDelete, "/t1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete twice: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := Handler(newMemModel(), Options{Actions: []Action{ActionList, ActionGet, ActionCreate, ActionUpdate}})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		field  string
+	}{
+		{"validation", http.MethodPost, "/", `{"priority":1}`, http.StatusBadRequest, "Title"},
+		{"unknown body field", http.MethodPost, "/", `{"title":"a","color":"red"}`, http.StatusBadRequest, ""},
+		{"malformed body", http.MethodPost, "/", `{"title":`, http.StatusBadRequest, ""},
+		{"read-only field", http.MethodPatch, "/t1", `{"id":"x"}`, http.StatusBadRequest, "id"},
+		{"wrong type", http.MethodPatch, "/t1", `{"priority":"high"}`, http.StatusBadRequest, "priority"},
+		{"empty update", http.MethodPatch, "/t1", `{}`, http.StatusBadRequest, ""},
+		{"update missing", http.MethodPatch, "/t9", `{"title":"a"}`, http.StatusNotFound, ""},
+		{"unknown filter", http.MethodGet, "/?color=red", "", http.StatusBadRequest, "color"},
+		{"include deleted", http.MethodGet, "/?include_deleted=true", "", http.StatusBadRequest, "include_deleted"},
+		{"invalid limit", http.MethodGet, "/?limit=-1", "", http.StatusBadRequest, "limit"},
+		{"disabled action", http.MethodDelete, "/t1", "", http.StatusMethodNotAllowed, ""},
+		{"nested path", http.MethodGet, "/t1/extra", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := serve(h, tt.method, tt.target, tt.body)
+		var body errorResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != tt.status || body.Field != tt.field || body.Error == "" {
+			t.Errorf("%s: expected %d with field %q, got %d %s", tt.name, tt.status, tt.field, rec.Code, rec.Body)
+		}
+	}
+	if allow := serve(h, http.MethodDelete, "/t1", "").Header().Get("Allow"); allow != "GET, PATCH" {
+		t.Errorf("expected Allow: GET, PATCH, got %q", allow)
+	}
+}
+
+func TestHandler_Authorization(t *testing.T) {
+	m := newMemModel()
+	h := Handler(m, Options{
+		Authorize: func(r *http.Request, action Action, id string) error {
+			if r.Header.Get("User") == "" {
+				return &Error{Status: http.StatusUnauthorized, Message: "sign in first"}
+			}
+			if action == ActionDelete {
+				return errors.New("deleting is not allowed")
+			}
+			return nil
+		},
+		Scope: func(r *http.Request, filters map[string]interface{}) error {
+			filters["owner_id"] = r.Header.Get("User")
+			return nil
+		},
+		AuthorizeDocument: func(r *http.Request, action Action, doc interface{}) error {
+			if doc.(*task).OwnerID != r.Header.Get("User") {
+				return &Error{Status: http.StatusNotFound, Message: "not found"}
+			}
+			return nil
+		},
+	})
+
+	do := func(method, target, user string) int {
+		req := httptest.NewRequest(method, target, nil)
+		if user != "" {
+			req.Header.Set("User", user)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(http.MethodGet, "/t1", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a user, got %d", code)
+	}
+	if code := do(http.MethodDelete, "/t1", "alice"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a rejected action, got %d", code)
+	}
+	if code := do(http.MethodGet, "/t1", "bob"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's document, got %d", code)
+	}
+	if code := do(http.MethodGet, "/t1", "alice"); code != http.StatusOK {
+		t.Errorf("expected 200 for the owner, got %d", code)
+	}
+	if code := do(http.MethodGet, "/?ownerId=bob", "alice"); code != http.StatusOK || m.filters["owner_id"] != "alice" {
+		t.Errorf("expected the scope to override the filter, got %d with %v", code, m.filters)
+	}
+}
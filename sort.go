@@ -0,0 +1,150 @@
+package firegorm
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// SortField is a single order-by clause.
+type SortField struct {
+	Field     string
+	Direction firestore.Direction
+}
+
+// String returns the clause in the notation accepted by ParseSort.
+func (s SortField) String() string {
+	if s.Direction == firestore.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// ParseSort parses a comma-separated sort specification such as
+// "-priority,created_at", where a leading "-" sorts that field descending
+// and an optional leading "+" sorts it ascending.
+func ParseSort(spec string) ([]SortField, error) {
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field := SortField{Field: part, Direction: firestore.Asc}
+		switch part[0] {
+		case '-':
+			field.Field, field.Direction = part[1:], firestore.Desc
+		case '+':
+			field.Field = part[1:]
+		}
+		if field.Field == "" {
+			return nil, invalid("", "invalid sort specification %q: missing field name", spec)
+		}
+		if seen[field.Field] {
+			return nil, invalid(field.Field, "invalid sort specification %q: field '%s' is repeated", spec, field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// SortBy orders the results of List, FindOne, Each and Iter. Each spec is
+// parsed with ParseSort, so SortBy("-priority", "created_at") and
+// SortBy("-priority,created_at") are equivalent.
+func SortBy(specs ...string) QueryOption {
+	return func(o *queryOptions) {
+		o.sort = append(o.sort, specs...)
+	}
+}
+
+// WithDefaultSort sets the order used by List, FindOne, Each and Iter when
+// the caller does not ask for one, e.g. WithDefaultSort("-created_at").
+func WithDefaultSort(spec string) ModelOption {
+	return func(info *ModelInfo) error {
+		fields, err := ParseSort(spec)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			if _, ok := info.TagToFieldMap[field.Field]; !ok && !baseFieldNames[field.Field] {
+				return fmt.Errorf("default sort field '%s' does not exist in the model", field.Field)
+			}
+		}
+		info.DefaultSort = fields
+		return nil
+	}
+}
+
+// resolveSort combines the legacy sortField/sortOrder pair, the SortBy options
+// and the model's default sort into the order-by clauses of a query.
+// With an empty sortOrder, sortField may hold a full sort specification.
+func (b *BaseModel) resolveSort(sortField, sortOrder string, options queryOptions) ([]SortField, error) {
+	var clauses []SortField
+
+	if sortField != "" {
+		switch sortOrder {
+		case "asc":
+			clauses = append(clauses, SortField{Field: sortField, Direction: firestore.Asc})
+		case "desc":
+			clauses = append(clauses, SortField{Field: sortField, Direction: firestore.Desc})
+		case "":
+			parsed, err := ParseSort(sortField)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, parsed...)
+		default:
+			return nil, invalid("sortOrder", "invalid sortOrder: %s. Must be 'asc' or 'desc'", sortOrder)
+		}
+	}
+
+	for _, spec := range options.sort {
+		parsed, err := ParseSort(spec)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, parsed...)
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		// Unregistered models can still be sorted; there is just nothing to validate against.
+		return clauses, nil
+	}
+	if len(clauses) == 0 {
+		clauses = info.DefaultSort
+	}
+
+	seen := make(map[string]bool)
+	for _, clause := range clauses {
+		if _, ok := info.TagToFieldMap[clause.Field]; !ok && !baseFieldNames[clause.Field] {
+			return nil, invalid(clause.Field, "cannot sort by '%s': field does not exist in the model for collection '%s'", clause.Field, b.CollectionName)
+		}
+		if seen[clause.Field] {
+			return nil, invalid(clause.Field, "cannot sort by '%s' more than once", clause.Field)
+		}
+		seen[clause.Field] = true
+	}
+	return clauses, nil
+}
+
+// applySort adds the order-by clauses to query, followed by the document ID in
+// the direction of the last clause so documents with equal sort values always
+// come back in the same order and cursor pagination is stable.
+func applySort(query firestore.Query, clauses []SortField) firestore.Query {
+	if len(clauses) == 0 {
+		return query
+	}
+	for _, clause := range clauses {
+		query = query.OrderBy(clause.Field, clause.Direction)
+	}
+	last := clauses[len(clauses)-1]
+	if last.Field != "id" && last.Field != firestore.DocumentID {
+		query = query.OrderBy(firestore.DocumentID, last.Direction)
+	}
+	return query
+}
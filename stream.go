@@ -0,0 +1,201 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// defaultPageSize is the number of documents fetched per round trip by Each and Iter.
+const defaultPageSize = 500
+
+// errStopIteration is returned internally when an Iter consumer breaks out of its loop.
+var errStopIteration = errors.New("iteration stopped")
+
+// Each streams the documents matching filters to fn one at a time, fetching
+// them lazily in pages and moving between pages with cursors. doc is a pointer
+// to a new instance of the registered model type. Iteration stops at the first
+// error returned by fn, which is returned as is, or when ctx is cancelled.
+func (b *BaseModel) Each(ctx context.Context, filters map[string]interface{}, fn func(doc interface{}) error, opts ...QueryOption) (err error) {
+	ctx, op := b.startOp(ctx, "Each", "")
+	defer func() { op.end(err) }()
+	op.setFilters(filters)
+
+	if err := b.EnsureCollection(); err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+
+	options := newQueryOptions(opts)
+
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+	if !options.includeDeleted {
+		query = query.Where("deleted", "==", false)
+	}
+
+	query, err = applyOperatorFilters(query, filters)
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed when applying filters: %v", err)
+		return err
+	}
+	query, err = applyWhere(query, options)
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+
+	clauses, err := b.resolveSort("", "", options)
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+
+	query, err = b.applySelect(query, cursorFields(options.selectFields, clauses))
+	if err != nil {
+		b.logf(ctx, ERROR, "Each failed: %v", err)
+		return err
+	}
+	query = applySort(query, clauses)
+	b.recordQuery(filters, clauses, options)
+
+	pageSize := options.pageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	var last *firestore.DocumentSnapshot
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page := query.Limit(pageSize)
+		if last != nil {
+			page = page.StartAfter(last)
+		}
+
+		var docs []interface{}
+		var items []reflect.Value
+		it := page.Documents(ctx)
+		for {
+			doc, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				it.Stop()
+				b.logf(ctx, ERROR, "Failed to iterate documents: %v", err)
+				return err
+			}
+			last = doc
+
+			item, err := decodeSnapshot(doc, info.Schema)
+			if err != nil {
+				it.Stop()
+				b.logf(ctx, ERROR, "Failed to map document data to model in Each: %v", err)
+				return err
+			}
+			docs = append(docs, item)
+			items = append(items, structValue(reflect.ValueOf(item)))
+		}
+		it.Stop()
+		addReads(ctx, max(len(docs), 1))
+
+		if err := b.preload(ctx, items, options.preload); err != nil {
+			return err
+		}
+
+		for _, doc := range docs {
+			if err := fn(doc); err != nil {
+				if errors.Is(err, errStopIteration) {
+					// The consumer of Iter broke out of its loop, which is not a failure.
+					b.logf(ctx, DEBUG, "Iter on collection '%s' stopped by the caller after %d document(s)", b.CollectionName, total)
+					op.set("result_count", total)
+					return nil
+				}
+				b.logf(ctx, DEBUG, "Each on collection '%s' stopped after %d document(s): %v", b.CollectionName, total, err)
+				return err
+			}
+			total++
+		}
+
+		if len(docs) < pageSize {
+			break
+		}
+	}
+
+	op.set("result_count", total)
+	b.logf(ctx, INFO, "Streamed %d documents from collection '%s' with filters: %v", total, b.CollectionName, redact(filters, b.sensitiveKeys()))
+	return nil
+}
+
+// Iter returns a range-over-func iterator over the documents matching filters,
+// with the same lazy paging as Each:
+//
+//	for doc, err := range model.Iter(ctx, filters) {
+//		if err != nil {
+//			return err
+//		}
+//		task := doc.(*Task)
+//	}
+//
+// Breaking out of the loop stops fetching further pages.
+func (b *BaseModel) Iter(ctx context.Context, filters map[string]interface{}, opts ...QueryOption) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		err := b.Each(ctx, filters, func(doc interface{}) error {
+			if !yield(doc, nil) {
+				return errStopIteration
+			}
+			return nil
+		}, opts...)
+		if err != nil && !errors.Is(err, errStopIteration) {
+			yield(nil, err)
+		}
+	}
+}
+
+// EachOf is the typed form of Each for models of type T.
+func EachOf[T any](ctx context.Context, b *BaseModel, filters map[string]interface{}, fn func(*T) error, opts ...QueryOption) error {
+	return b.Each(ctx, filters, func(doc interface{}) error {
+		typed, ok := doc.(*T)
+		if !ok {
+			return errors.New("model type does not match the registered schema")
+		}
+		return fn(typed)
+	}, opts...)
+}
+
+// IterOf is the typed form of Iter for models of type T.
+func IterOf[T any](ctx context.Context, b *BaseModel, filters map[string]interface{}, opts ...QueryOption) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for doc, err := range b.Iter(ctx, filters, opts...) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			typed, ok := doc.(*T)
+			if !ok {
+				yield(nil, errors.New("model type does not match the registered schema"))
+				return
+			}
+			if !yield(typed, nil) {
+				return
+			}
+		}
+	}
+}
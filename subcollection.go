@@ -0,0 +1,140 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// parseCollectionTemplate validates a collection path and returns the names of
+// its parent placeholders. A flat collection such as "orders" has none, while
+// "orders/{orderID}/items" has one ("orderID").
+func parseCollectionTemplate(template string) ([]string, error) {
+	segments := strings.Split(template, "/")
+	if len(segments)%2 == 0 {
+		return nil, fmt.Errorf("invalid collection path '%s': must end with a collection segment", template)
+	}
+
+	var params []string
+	for i, segment := range segments {
+		isParam := strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+		switch {
+		case segment == "":
+			return nil, fmt.Errorf("invalid collection path '%s': empty segment", template)
+		case i%2 == 0 && isParam:
+			return nil, fmt.Errorf("invalid collection path '%s': collection segment '%s' cannot be a placeholder", template, segment)
+		case i%2 == 1 && !isParam:
+			return nil, fmt.Errorf("invalid collection path '%s': document segment '%s' must be a placeholder like {id}", template, segment)
+		case isParam:
+			params = append(params, segment[1:len(segment)-1])
+		}
+	}
+	return params, nil
+}
+
+// In returns a copy of the model bound to the given parent document IDs, in the
+// order their placeholders appear in the collection path. For a model registered
+// as "orders/{orderID}/items", items.In(orderID) operates on that order's items.
+func (b *BaseModel) In(parentIDs ...string) *BaseModel {
+	bound := *b
+	bound.parentIDs = append([]string(nil), parentIDs...)
+	bound.group = false
+	b.log(DEBUG, "Bound model '%s' to parents %v", b.CollectionName, parentIDs)
+	return &bound
+}
+
+// Group returns a copy of the model that queries the collection group, i.e.
+// every collection with the same final segment regardless of its parent.
+// Only read operations are supported on a group handle.
+func (b *BaseModel) Group() *BaseModel {
+	grouped := *b
+	grouped.parentIDs = nil
+	grouped.group = true
+	b.log(DEBUG, "Using collection group for model '%s'", b.CollectionName)
+	return &grouped
+}
+
+// collectionPath resolves the collection path template with the bound parent
+// IDs and, for models scoped by tenant path, the tenant of ctx.
+func (b *BaseModel) collectionPath(ctx context.Context) (string, error) {
+	if b.group {
+		return "", fmt.Errorf("operation not supported on collection group '%s'; bind the model to its parents with In", b.CollectionName)
+	}
+
+	segments := strings.Split(b.CollectionName, "/")
+	expected := len(segments) / 2
+	if len(b.parentIDs) != expected {
+		return "", fmt.Errorf("collection '%s' requires %d parent ID(s), got %d; use In to bind them", b.CollectionName, expected, len(b.parentIDs))
+	}
+
+	for i := 1; i < len(segments); i += 2 {
+		id := b.parentIDs[i/2]
+		if id == "" || strings.Contains(id, "/") {
+			return "", fmt.Errorf("invalid parent ID %q for collection '%s'", id, b.CollectionName)
+		}
+		segments[i] = id
+	}
+	return b.tenancy().scopePath(ctx, strings.Join(segments, "/"))
+}
+
+// collectionRef returns the Firestore collection this model operates on.
+func (b *BaseModel) collectionRef(ctx context.Context) (*firestore.CollectionRef, error) {
+	path, err := b.collectionPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return b.database().Client().Collection(path), nil
+}
+
+// baseQuery returns the unfiltered query for this model: the bound collection,
+// or every collection in the group for handles returned by Group. Models
+// scoped by tenant only see the documents of the tenant of ctx.
+func (b *BaseModel) baseQuery(ctx context.Context) (firestore.Query, error) {
+	tenancy := b.tenancy()
+	if !b.group {
+		col, err := b.collectionRef(ctx)
+		if err != nil {
+			return firestore.Query{}, err
+		}
+		return tenancy.scopeQuery(ctx, col.Query, b.CollectionName)
+	}
+	if tenancy != nil && tenancy.Mode == TenantPath {
+		return firestore.Query{}, fmt.Errorf("collection group queries are not supported on '%s', which is scoped by tenant path", b.CollectionName)
+	}
+	segments := strings.Split(b.CollectionName, "/")
+	return tenancy.scopeQuery(ctx, b.database().Client().CollectionGroup(segments[len(segments)-1]).Query, b.CollectionName)
+}
+
+// getDoc fetches a document snapshot by ID. On a collection group handle the
+// document is looked up through its stored "id" field.
+func (b *BaseModel) getDoc(ctx context.Context, id string) (*firestore.DocumentSnapshot, error) {
+	if !b.group {
+		col, err := b.collectionRef(ctx)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := col.Doc(id).Get(ctx)
+		if err == nil && !b.tenancy().owns(ctx, doc) {
+			// Documents of other tenants are reported as missing.
+			return nil, notFound("document with ID '%s' not found in collection '%s'", id, b.CollectionName)
+		}
+		return doc, err
+	}
+
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iter := query.Where("id", "==", id).Limit(1).Documents(ctx)
+	defer iter.Stop()
+
+	doc, err := iter.Next()
+	if errors.Is(err, iterator.Done) {
+		return nil, notFound("document with ID '%s' not found in collection group '%s'", id, b.CollectionName)
+	}
+	return doc, err
+}
@@ -0,0 +1,35 @@
+package firegorm
+
+import "strings"
+
+// tagDirective is a single entry of a `firegorm` struct tag. Directives are
+// separated by ";" and take the form name[:value][,key=option...], e.g.
+// `firegorm:"belongs_to:users,fk=user_id"`.
+type tagDirective struct {
+	Name    string
+	Value   string
+	Options map[string]string
+}
+
+// parseFiregormTag splits a `firegorm` struct tag into its directives.
+func parseFiregormTag(tag string) []tagDirective {
+	var directives []tagDirective
+	for _, raw := range strings.Split(tag, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		parts := strings.Split(raw, ",")
+		d := tagDirective{Options: make(map[string]string)}
+		d.Name, d.Value, _ = strings.Cut(strings.TrimSpace(parts[0]), ":")
+		for _, opt := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			if key != "" {
+				d.Options[key] = value
+			}
+		}
+		directives = append(directives, d)
+	}
+	return directives
+}
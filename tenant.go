@@ -0,0 +1,244 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+)
+
+// TenantMode selects how the documents of a tenant-scoped model are kept apart.
+type TenantMode int
+
+const (
+	// TenantPath stores each tenant's documents under its own document of a
+	// root collection, so "tasks" becomes "tenants/{tenantID}/tasks".
+	TenantPath TenantMode = iota + 1
+	// TenantField stores the documents of every tenant in one collection,
+	// with the tenant ID in a field that is stamped on writes and filtered on reads.
+	TenantField
+)
+
+// Tenancy describes how a model is scoped by tenant. It is set at
+// registration with WithTenantPath or WithTenantField.
+type Tenancy struct {
+	Mode  TenantMode
+	Root  string // Root collection of the tenant documents, for TenantPath
+	Field string // Firestore field holding the tenant ID, for TenantField
+}
+
+// String describes the scoping, e.g. "path tenants/{tenantID}" or "field tenant_id".
+func (t *Tenancy) String() string {
+	switch {
+	case t == nil:
+		return "none"
+	case t.Mode == TenantPath:
+		return "path " + t.Root + "/{tenantID}"
+	}
+	return "field " + t.Field
+}
+
+// ErrNoTenant is matched by the errors of operations on tenant-scoped models
+// whose context carries no tenant.
+var ErrNoTenant = errors.New("no tenant in context")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant ID that tenant-scoped
+// models read and write with. Set it once per request, for example in an
+// authentication middleware.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID set with WithTenant.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// WithTenantPath scopes a model by storing each tenant's documents under
+// root/{tenantID}, e.g. WithTenantPath("tenants") for "tenants/acme/tasks".
+func WithTenantPath(root string) ModelOption {
+	return func(info *ModelInfo) error {
+		if info.Tenancy != nil {
+			return fmt.Errorf("model for collection '%s' is already scoped by tenant", info.CollectionName)
+		}
+		if root == "" || strings.ContainsAny(root, "/{}") {
+			return fmt.Errorf("invalid tenant root collection '%s': must be a single collection ID", root)
+		}
+		info.Tenancy = &Tenancy{Mode: TenantPath, Root: root}
+		return nil
+	}
+}
+
+// WithTenantField scopes a model by a string field holding the tenant ID,
+// usually "tenant_id". The field is set on every created or imported
+// document, cannot be updated, and every read is filtered by it.
+func WithTenantField(field string) ModelOption {
+	return func(info *ModelInfo) error {
+		if info.Tenancy != nil {
+			return fmt.Errorf("model for collection '%s' is already scoped by tenant", info.CollectionName)
+		}
+		stored, ok := info.storedName(field)
+		if !ok || stored != field || baseFieldNames[field] {
+			return fmt.Errorf("tenant field '%s' is not a Firestore field of model '%s'", field, info.Schema.Name())
+		}
+		if goField, _ := info.Schema.FieldByName(info.TagToFieldMap[field]); goField.Type.Kind() != reflect.String {
+			return fmt.Errorf("tenant field '%s' of model '%s' must be a string", field, info.Schema.Name())
+		}
+		info.Tenancy = &Tenancy{Mode: TenantField, Field: field}
+		return nil
+	}
+}
+
+// tenancy returns the tenant scoping of the model, or nil if it has none.
+func (b *BaseModel) tenancy() *Tenancy {
+	info, ok := b.database().registry().get(b.CollectionName + "." + b.ModelName)
+	if !ok {
+		return nil
+	}
+	return info.Tenancy
+}
+
+// tenantID returns the tenant of ctx, failing if there is none.
+func (t *Tenancy) tenantID(ctx context.Context, collection string) (string, error) {
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("collection '%s' is scoped by tenant: %w", collection, ErrNoTenant)
+	}
+	if t.Mode == TenantPath && strings.Contains(tenantID, "/") {
+		return "", fmt.Errorf("invalid tenant ID %q for collection '%s'", tenantID, collection)
+	}
+	return tenantID, nil
+}
+
+// scopePath prefixes a collection path with the tenant document of ctx.
+func (t *Tenancy) scopePath(ctx context.Context, path string) (string, error) {
+	if t == nil || t.Mode != TenantPath {
+		return path, nil
+	}
+	tenantID, err := t.tenantID(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return t.Root + "/" + tenantID + "/" + path, nil
+}
+
+// scopeQuery restricts a query to the tenant of ctx.
+func (t *Tenancy) scopeQuery(ctx context.Context, query firestore.Query, collection string) (firestore.Query, error) {
+	if t == nil || t.Mode != TenantField {
+		return query, nil
+	}
+	tenantID, err := t.tenantID(ctx, collection)
+	if err != nil {
+		return query, err
+	}
+	return query.Where(t.Field, "==", tenantID), nil
+}
+
+// owns reports whether a fetched document belongs to the tenant of ctx.
+// Documents of models scoped by path always do, as they were read under it.
+func (t *Tenancy) owns(ctx context.Context, doc *firestore.DocumentSnapshot) bool {
+	if t == nil || t.Mode != TenantField || !doc.Exists() {
+		return true
+	}
+	tenantID, ok := TenantFromContext(ctx)
+	stored, _ := doc.Data()[t.Field].(string)
+	return ok && stored == tenantID
+}
+
+// stamp sets the tenant field of a document struct to the tenant of ctx.
+func (t *Tenancy) stamp(ctx context.Context, doc reflect.Value, info ModelInfo) error {
+	if t == nil || t.Mode != TenantField {
+		return nil
+	}
+	tenantID, err := t.tenantID(ctx, info.CollectionName)
+	if err != nil {
+		return err
+	}
+	field := doc.FieldByName(info.TagToFieldMap[t.Field])
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return fmt.Errorf("data of type '%s' has no tenant field '%s'", doc.Type(), t.Field)
+	}
+	field.SetString(tenantID)
+	return nil
+}
+
+// checkOwnership fails if any of the documents exists and belongs to another
+// tenant, so writes with caller-chosen IDs cannot overwrite it.
+func (t *Tenancy) checkOwnership(ctx context.Context, client *firestore.Client, refs []*firestore.DocumentRef) error {
+	if t == nil || t.Mode != TenantField || len(refs) == 0 {
+		return nil
+	}
+	docs, err := client.GetAll(ctx, refs)
+	addReads(ctx, len(refs))
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if !t.owns(ctx, doc) {
+			return fmt.Errorf("document '%s' belongs to another tenant", doc.Ref.ID)
+		}
+	}
+	return nil
+}
+
+// tenancyOf returns the tenant scoping of the model registered with the given
+// collection, for relations, which name collections rather than models.
+func (db *DB) tenancyOf(collection string) *Tenancy {
+	models := db.registry()
+	for _, name := range models.names() {
+		if info, ok := models.get(name); ok && info.CollectionName == collection && info.Tenancy != nil {
+			return info.Tenancy
+		}
+	}
+	return nil
+}
+
+// scopeIndexes prefixes the composite indexes of a model scoped by tenant
+// field with that field, which every query filters on.
+func (t *Tenancy) scopeIndexes(indexes []Index) []Index {
+	if t == nil || t.Mode != TenantField {
+		return indexes
+	}
+	scoped := make([]Index, 0, len(indexes))
+	for _, ix := range indexes {
+		listed := false
+		for _, f := range ix.Fields {
+			listed = listed || f.Field == t.Field
+		}
+		if !listed {
+			ix.Fields = append([]IndexField{{Field: t.Field, Direction: firestore.Asc}}, ix.Fields...)
+		}
+		scoped = append(scoped, ix)
+	}
+	return scoped
+}
+
+// stampTenant sets the tenant field of a document about to be created.
+func (b *BaseModel) stampTenant(ctx context.Context, doc reflect.Value) error {
+	info, ok := b.database().registry().get(b.CollectionName + "." + b.ModelName)
+	if !ok {
+		return nil
+	}
+	return info.Tenancy.stamp(ctx, doc, info)
+}
+
+// checkTenant guards updates of models scoped by tenant field: the tenant
+// field cannot change, and documents of other tenants are reported as missing.
+func (b *BaseModel) checkTenant(ctx context.Context, id string, updates map[string]interface{}) error {
+	t := b.tenancy()
+	if t == nil || t.Mode != TenantField {
+		return nil
+	}
+	if _, ok := updates[t.Field]; ok {
+		return invalid(t.Field, "field '%s' holds the tenant and cannot be updated", t.Field)
+	}
+	_, err := b.getDoc(ctx, id)
+	addReads(ctx, 1)
+	return err
+}
@@ -0,0 +1,61 @@
+package firegorm
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName identifies Firegorm's spans and metrics.
+const instrumentationName = "github.com/GEMSDEV-mx/firegorm"
+
+// tracer creates the spans around ORM operations and hooks. Tracing is off
+// until a provider is configured.
+var tracer = guarded[trace.Tracer]{v: noop.NewTracerProvider().Tracer(instrumentationName)}
+
+// SetTracerProvider enables OpenTelemetry tracing: every operation (Create,
+// Get, Update, Delete, List, Count, ...) and every RunHooks call gets a span.
+// Passing nil turns tracing off again.
+func SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	tracer.store(tp.Tracer(instrumentationName))
+}
+
+// startSpan starts a client span for a Firestore-backed operation.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("db.system", "firestore"))
+	return tracer.load().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanAttribute converts an operation attribute to a span attribute.
+func spanAttribute(key string, value interface{}) attribute.KeyValue {
+	key = "firegorm." + key
+	switch v := value.(type) {
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case string:
+		return attribute.String(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
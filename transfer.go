@@ -0,0 +1,521 @@
+package firegorm
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Format is a file format supported by Export and Import.
+type Format string
+
+const (
+	// JSONL writes one JSON object per line.
+	JSONL Format = "jsonl"
+	// CSV writes a header row of field names and one row per document.
+	// Strings, numbers, booleans and timestamps are written as plain values;
+	// slices, maps and nested structs as JSON.
+	CSV Format = "csv"
+)
+
+// ParseFormat returns the Format named by s, such as "jsonl" or "csv".
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSONL, CSV:
+		return f, nil
+	case "json", "ndjson":
+		return JSONL, nil
+	}
+	return "", fmt.Errorf("unsupported format '%s': use jsonl or csv", s)
+}
+
+// TransferOption configures Export and Import.
+type TransferOption func(*transferOptions)
+
+type transferOptions struct {
+	includeDeleted bool
+	where          []string
+	validate       bool
+	batchSize      int
+}
+
+// ExportIncludeDeleted also exports soft-deleted documents, which are skipped
+// by default. Use it for backups.
+func ExportIncludeDeleted() TransferOption {
+	return func(o *transferOptions) {
+		o.includeDeleted = true
+	}
+}
+
+// ExportWhere restricts Export to the documents matching a filter
+// expression, in addition to the filters map. See ParseFilterExpr.
+func ExportWhere(expr string) TransferOption {
+	return func(o *transferOptions) {
+		o.where = append(o.where, expr)
+	}
+}
+
+// ImportValidate runs ValidateStruct on every record before it is written.
+func ImportValidate() TransferOption {
+	return func(o *transferOptions) {
+		o.validate = true
+	}
+}
+
+// ImportBatchSize sets how many documents Import writes per batch. It is
+// capped at 500, the Firestore limit, and defaults to 500.
+func ImportBatchSize(n int) TransferOption {
+	return func(o *transferOptions) {
+		o.batchSize = n
+	}
+}
+
+// Export writes the documents of a registered model matching filters to w,
+// encoded with the model's json tags. Filters use the notation of List.
+// It returns the number of documents written.
+func Export(ctx context.Context, model interface{}, filters map[string]interface{}, w io.Writer, format Format, opts ...TransferOption) (int, error) {
+	handle, ok := model.(interface{ baseModel() *BaseModel })
+	if !ok {
+		return 0, fmt.Errorf("cannot export %T: expected a model registered with RegisterModel", model)
+	}
+	return handle.baseModel().export(ctx, filters, w, format, newTransferOptions(opts))
+}
+
+// Import reads records written by Export, or by hand in the same format,
+// and stores them in the collection of a registered model. Records keep
+// their id and timestamps; records without an id get a new one and the
+// current time, as with Create. Documents are written in batches and hooks
+// do not run. Import stops at the first invalid record, keeping the batches
+// already written, and returns the number of documents written.
+func Import(ctx context.Context, model interface{}, r io.Reader, format Format, opts ...TransferOption) (int, error) {
+	handle, ok := model.(interface{ baseModel() *BaseModel })
+	if !ok {
+		return 0, fmt.Errorf("cannot import into %T: expected a model registered with RegisterModel", model)
+	}
+	return handle.baseModel().importRecords(ctx, r, format, newTransferOptions(opts))
+}
+
+func newTransferOptions(opts []TransferOption) transferOptions {
+	o := transferOptions{batchSize: 500}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batchSize <= 0 || o.batchSize > 500 {
+		o.batchSize = 500
+	}
+	return o
+}
+
+func (b *BaseModel) export(ctx context.Context, filters map[string]interface{}, w io.Writer, format Format, options transferOptions) (count int, err error) {
+	ctx, op := b.startOp(ctx, "Export", "")
+	defer func() { op.end(err) }()
+	op.setFilters(filters)
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "Export failed: %v", err)
+		return 0, err
+	}
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Export failed: %v", err)
+		return 0, err
+	}
+	if !options.includeDeleted {
+		query = query.Where("deleted", "==", false)
+	}
+	query, err = applyOperatorFilters(query, filters)
+	if err != nil {
+		b.logf(ctx, ERROR, "Export failed when applying filters: %v", err)
+		return 0, err
+	}
+	query, err = applyWhere(query, queryOptions{where: options.where})
+	if err != nil {
+		b.logf(ctx, ERROR, "Export failed: %v", err)
+		return 0, err
+	}
+
+	var enc recordEncoder
+	switch format {
+	case JSONL:
+		enc = &jsonlEncoder{enc: json.NewEncoder(w)}
+	case CSV:
+		enc = newCSVEncoder(w, info.Schema)
+	default:
+		err := fmt.Errorf("unsupported format '%s'", format)
+		b.logf(ctx, ERROR, "Export failed: %v", err)
+		return 0, err
+	}
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			b.logf(ctx, ERROR, "Export of collection '%s' failed: %v", b.CollectionName, err)
+			return count, err
+		}
+		item, err := decodeDocument(doc, info.Schema)
+		if err != nil {
+			b.logf(ctx, ERROR, "Export failed: %v", err)
+			return count, err
+		}
+		if err := enc.encode(item.Interface()); err != nil {
+			b.logf(ctx, ERROR, "Export failed writing document '%s': %v", doc.Ref.ID, err)
+			return count, err
+		}
+		count++
+	}
+	if err := enc.flush(); err != nil {
+		b.logf(ctx, ERROR, "Export failed: %v", err)
+		return count, err
+	}
+
+	addReads(ctx, max(count, 1))
+	op.set("result_count", count)
+	b.logf(ctx, INFO, "Exported %d documents from collection '%s' as %s", count, b.CollectionName, format)
+	return count, nil
+}
+
+func (b *BaseModel) importRecords(ctx context.Context, r io.Reader, format Format, options transferOptions) (count int, err error) {
+	ctx, op := b.startOp(ctx, "Import", "")
+	defer func() { op.end(err) }()
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "Import failed: %v", err)
+		return 0, err
+	}
+	col, err := b.collectionRef(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Import failed: %v", err)
+		return 0, err
+	}
+
+	var dec recordDecoder
+	switch format {
+	case JSONL:
+		dec = &jsonlDecoder{dec: json.NewDecoder(r)}
+	case CSV:
+		dec, err = newCSVDecoder(r, info.Schema)
+		if err != nil {
+			b.logf(ctx, ERROR, "Import failed: %v", err)
+			return 0, err
+		}
+	default:
+		err := fmt.Errorf("unsupported format '%s'", format)
+		b.logf(ctx, ERROR, "Import failed: %v", err)
+		return 0, err
+	}
+
+	db := b.database()
+	var batch []reflect.Value
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		refs := make([]*firestore.DocumentRef, len(batch))
+		for i, doc := range batch {
+			refs[i] = col.Doc(doc.Elem().FieldByName("ID").String())
+		}
+		if err := info.Tenancy.checkOwnership(ctx, db.Client(), refs); err != nil {
+			batch = batch[:0]
+			return err
+		}
+		written, err := writeBatch(ctx, db.Client(), col, batch)
+		count += written
+		addWrites(ctx, written)
+		batch = batch[:0]
+		return err
+	}
+
+	for record := 1; ; record++ {
+		item := reflect.New(info.Schema)
+		err := dec.decode(item.Interface())
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("record %d: %w", record, err)
+			b.logf(ctx, ERROR, "Import into collection '%s' failed: %v", b.CollectionName, err)
+			return count, err
+		}
+		if err := info.Tenancy.stamp(ctx, item.Elem(), info); err != nil {
+			b.logf(ctx, ERROR, "Import failed: %v", err)
+			return count, err
+		}
+		if options.validate {
+			if err := ValidateStruct(item.Interface()); err != nil {
+				err = fmt.Errorf("record %d: %w", record, err)
+				b.logf(ctx, ERROR, "Import into collection '%s' failed: %v", b.CollectionName, err)
+				return count, err
+			}
+		}
+		if err := prepareImport(item.Elem(), db); err != nil {
+			b.logf(ctx, ERROR, "Import failed: %v", err)
+			return count, err
+		}
+
+		batch = append(batch, item)
+		if len(batch) == options.batchSize {
+			if err := flush(); err != nil {
+				b.logf(ctx, ERROR, "Import into collection '%s' failed after %d documents: %v", b.CollectionName, count, err)
+				return count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		b.logf(ctx, ERROR, "Import into collection '%s' failed after %d documents: %v", b.CollectionName, count, err)
+		return count, err
+	}
+
+	op.set("result_count", count)
+	b.logf(ctx, INFO, "Imported %d documents into collection '%s' from %s", count, b.CollectionName, format)
+	return count, nil
+}
+
+// prepareImport fills the ID and timestamps an imported record lacks.
+func prepareImport(doc reflect.Value, db *DB) error {
+	if doc.FieldByName("ID").String() == "" {
+		_, err := prepareCreate(doc, db.now())
+		return err
+	}
+	for _, name := range []string{"CreatedAt", "UpdatedAt", "Deleted", "DeletedAt"} {
+		if !doc.FieldByName(name).IsValid() {
+			return fmt.Errorf("data of type '%s' has no %s field; embed firegorm.BaseModel", doc.Type(), name)
+		}
+	}
+	now := db.now()
+	if created := doc.FieldByName("CreatedAt"); created.IsZero() {
+		created.Set(reflect.ValueOf(now))
+	}
+	if updated := doc.FieldByName("UpdatedAt"); updated.IsNil() {
+		updated.Set(reflect.ValueOf(&now))
+	}
+	return nil
+}
+
+// writeBatch stores the documents with a BulkWriter and returns how many were written.
+func writeBatch(ctx context.Context, client *firestore.Client, col *firestore.CollectionRef, docs []reflect.Value) (int, error) {
+	bw := client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+	for _, doc := range docs {
+		job, err := bw.Set(col.Doc(doc.Elem().FieldByName("ID").String()), doc.Interface())
+		if err != nil {
+			bw.End()
+			return 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+
+	written := 0
+	var errs []error
+	for i, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			errs = append(errs, fmt.Errorf("document '%s': %w", docs[i].Elem().FieldByName("ID").String(), err))
+			continue
+		}
+		written++
+	}
+	return written, errors.Join(errs...)
+}
+
+// recordEncoder writes exported documents.
+type recordEncoder interface {
+	encode(v interface{}) error
+	flush() error
+}
+
+// recordDecoder reads imported records. decode returns io.EOF after the last one.
+type recordDecoder interface {
+	decode(v interface{}) error
+}
+
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlEncoder) encode(v interface{}) error { return e.enc.Encode(v) }
+func (e *jsonlEncoder) flush() error               { return nil }
+
+type jsonlDecoder struct {
+	dec *json.Decoder
+}
+
+func (d *jsonlDecoder) decode(v interface{}) error { return d.dec.Decode(v) }
+
+// csvColumn is a CSV column: the json name of a field and its type.
+type csvColumn struct {
+	name string
+	typ  reflect.Type
+}
+
+// csvColumns returns the columns of a model's CSV form, in struct field
+// order with embedded structs flattened.
+func csvColumns(t reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := tagName(field.Tag.Get("json"))
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			columns = append(columns, csvColumns(field.Type)...)
+			continue
+		}
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, csvColumn{name: name, typ: field.Type})
+	}
+	return columns
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []csvColumn
+	header  bool
+}
+
+func newCSVEncoder(w io.Writer, schema reflect.Type) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w), columns: csvColumns(schema)}
+}
+
+// encode goes through the JSON form of v so the json tags and any custom
+// marshalers apply, then unquotes strings and leaves null values empty.
+func (e *csvEncoder) encode(v interface{}) error {
+	if !e.header {
+		names := make([]string, len(e.columns))
+		for i, c := range e.columns {
+			names[i] = c.name
+		}
+		if err := e.w.Write(names); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	row := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		raw := fields[c.name]
+		switch {
+		case len(raw) == 0 || string(raw) == "null":
+		case raw[0] == '"':
+			if err := json.Unmarshal(raw, &row[i]); err != nil {
+				return err
+			}
+		default:
+			row[i] = string(raw)
+		}
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns []csvColumn
+}
+
+// newCSVDecoder reads the header row and matches it with the model's fields.
+func newCSVDecoder(r io.Reader, schema reflect.Type) (*csvDecoder, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return &csvDecoder{r: cr}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	known := make(map[string]reflect.Type)
+	for _, c := range csvColumns(schema) {
+		known[c.name] = c.typ
+	}
+	columns := make([]csvColumn, len(header))
+	for i, name := range header {
+		typ, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("CSV column '%s' does not exist in the model", name)
+		}
+		columns[i] = csvColumn{name: name, typ: typ}
+	}
+	return &csvDecoder{r: cr, columns: columns}, nil
+}
+
+// decode builds the JSON form of a row and unmarshals it into v.
+func (d *csvDecoder) decode(v interface{}) error {
+	row, err := d.r.Read()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range d.columns {
+		value, err := csvValue(row[i], c.typ)
+		if err != nil {
+			return fmt.Errorf("column '%s': %w", c.name, err)
+		}
+		if value == nil {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(c.name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return json.Unmarshal(buf.Bytes(), v)
+}
+
+// csvValue returns the JSON form of a cell for a field of type t, or nil
+// for an empty cell, which leaves the field at its zero value.
+func csvValue(cell string, t reflect.Type) (json.RawMessage, error) {
+	ptr := t.Kind() == reflect.Ptr
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String && !ptr {
+		return json.Marshal(cell)
+	}
+	if cell == "" {
+		return nil, nil
+	}
+	if t.Kind() == reflect.String || t == timeType {
+		return json.Marshal(cell)
+	}
+	if !json.Valid([]byte(cell)) {
+		return nil, fmt.Errorf("invalid value %q for %s", cell, t)
+	}
+	return json.RawMessage(cell), nil
+}
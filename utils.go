@@ -22,12 +22,21 @@ func updatesToFirestoreUpdates(updates map[string]interface{}) []firestore.Updat
 			Path:  key,
 			Value: value,
 		})
-		Log(DEBUG, "Added Firestore update: Path=%s, Value=%v", key, value)
+		Log(DEBUG, "Added Firestore update: Path=%s", key)
 	}
-	Log(INFO, "Converted updates to Firestore format: %+v", firestoreUpdates)
+	Log(INFO, "Converted %d updates to Firestore format", len(firestoreUpdates))
 	return firestoreUpdates
 }
 
+// copyUpdates returns a shallow copy of an update map.
+func copyUpdates(updates map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(updates))
+	for key, value := range updates {
+		copied[key] = value
+	}
+	return copied
+}
+
 // ExtractFilters converts a map of query parameters (key-value strings) into a filters map.
 // Any parameter value that contains a comma is split into a []string.
 // The caller can pass a slice of keys to exclude from processing.
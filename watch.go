@@ -0,0 +1,404 @@
+package firegorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChangeType describes how a document changed between two snapshots.
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeRemoved  ChangeType = "removed"
+)
+
+// ChangeEvent is a single change delivered by Watch or WatchQuery.
+type ChangeEvent struct {
+	Type ChangeType
+	ID   string
+	// Data is a pointer to a new instance of the registered model type.
+	// For removed events it holds the last known state when Firestore provides it.
+	Data     interface{}
+	ReadTime time.Time
+	// Err is only set on the last event sent before the channel is closed
+	// because the listener failed with a non-transient error, or kept failing
+	// with Unknown or Internal errors.
+	Err error
+}
+
+// Reconnect delays of listeners; variables so tests can shorten them.
+var (
+	watchInitialBackoff = 500 * time.Millisecond
+	watchMaxBackoff     = 30 * time.Second
+)
+
+const (
+	watchBufferSize = 16
+	// watchMaxUncertainRetries caps the consecutive reconnects after Unknown
+	// or Internal errors, which may be permanent failures in disguise.
+	watchMaxUncertainRetries = 5
+)
+
+// Watch listens for changes to a single document. A soft delete, or the
+// document disappearing, is delivered as a ChangeRemoved event.
+// The returned channel is closed when ctx is cancelled or the listener fails.
+func (b *BaseModel) Watch(ctx context.Context, id string) (<-chan ChangeEvent, error) {
+	if err := b.EnsureCollection(); err != nil {
+		b.logf(ctx, ERROR, "Watch failed: %v", err)
+		return nil, err
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "Watch failed: %v", err)
+		return nil, err
+	}
+	schema := info.Schema
+
+	col, err := b.collectionRef(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "Watch failed: %v", err)
+		return nil, err
+	}
+	ref := col.Doc(id)
+	tenancy := b.tenancy()
+	ch := make(chan ChangeEvent, watchBufferSize)
+
+	go func() {
+		defer close(ch)
+
+		var lastUpdate time.Time
+		present := false
+
+		b.runWatch(ctx, ch, func() error {
+			it := ref.Snapshots(ctx)
+			defer it.Stop()
+
+			for {
+				snap, err := it.Next()
+				if err != nil {
+					return err
+				}
+
+				// A document of another tenant is reported as missing.
+				owned := tenancy.owns(ctx, snap)
+				alive := snap.Exists() && !isSoftDeleted(snap) && owned
+				kind, changed := documentChange(present, alive, lastUpdate, snap.UpdateTime)
+				if !changed {
+					// Nothing observable changed (e.g. the first snapshot after a reconnect).
+					continue
+				}
+				ev := ChangeEvent{Type: kind}
+
+				present = alive
+				lastUpdate = snap.UpdateTime
+				ev.ID = id
+				ev.ReadTime = snap.ReadTime
+				if snap.Exists() && owned {
+					data, err := decodeSnapshot(snap, schema)
+					if err != nil {
+						return err
+					}
+					ev.Data = data
+				}
+				if !sendEvent(ctx, ch, ev) {
+					return ctx.Err()
+				}
+			}
+		})
+	}()
+
+	b.logf(ctx, INFO, "Watching document '%s' in collection '%s'", id, b.CollectionName)
+	return ch, nil
+}
+
+// WatchQuery listens for changes to the documents matching filters, using the
+// same operator notation as List. Documents that are soft deleted leave the
+// result set and are delivered as ChangeRemoved events.
+// The returned channel is closed when ctx is cancelled or the listener fails.
+func (b *BaseModel) WatchQuery(ctx context.Context, filters map[string]interface{}) (<-chan ChangeEvent, error) {
+	if err := b.EnsureCollection(); err != nil {
+		b.logf(ctx, ERROR, "WatchQuery failed: %v", err)
+		return nil, err
+	}
+
+	info, err := b.modelInfo()
+	if err != nil {
+		b.logf(ctx, ERROR, "WatchQuery failed: %v", err)
+		return nil, err
+	}
+	schema := info.Schema
+
+	query, err := b.baseQuery(ctx)
+	if err != nil {
+		b.logf(ctx, ERROR, "WatchQuery failed: %v", err)
+		return nil, err
+	}
+	query = query.Where("deleted", "==", false)
+	query, err = applyOperatorFilters(query, filters)
+	if err != nil {
+		b.logf(ctx, ERROR, "WatchQuery failed when applying filters: %v", err)
+		return nil, err
+	}
+	b.recordQuery(filters, nil, queryOptions{})
+
+	ch := make(chan ChangeEvent, watchBufferSize)
+
+	go func() {
+		defer close(ch)
+
+		// known tracks the update time of every document currently in the
+		// result set, so a reconnect can be turned into a diff instead of
+		// replaying every document as "added".
+		known := make(map[string]time.Time)
+
+		b.runWatch(ctx, ch, func() error {
+			it := query.Snapshots(ctx)
+			defer it.Stop()
+
+			resync := len(known) > 0
+			for {
+				snap, err := it.Next()
+				if err != nil {
+					return err
+				}
+
+				var events []ChangeEvent
+				if resync {
+					events, err = resyncEvents(snap, known, schema)
+					resync = false
+				} else {
+					events, err = changeEvents(snap, known, schema)
+				}
+				if err != nil {
+					return err
+				}
+
+				for _, ev := range events {
+					if !sendEvent(ctx, ch, ev) {
+						return ctx.Err()
+					}
+				}
+			}
+		})
+	}()
+
+	b.logf(ctx, INFO, "Watching query on collection '%s' with filters: %v", b.CollectionName, redact(filters, b.sensitiveKeys()))
+	return ch, nil
+}
+
+// runWatch runs listen until ctx is done, restarting it with exponential
+// backoff whenever it fails with a transient error. Any other error is sent
+// on ch as a final event.
+func (b *BaseModel) runWatch(ctx context.Context, ch chan<- ChangeEvent, listen func() error) {
+	backoff := watchInitialBackoff
+	uncertain := 0
+	for {
+		started := time.Now()
+		err := listen()
+		if ctx.Err() != nil {
+			b.logf(ctx, DEBUG, "Watch on collection '%s' stopped: %v", b.CollectionName, ctx.Err())
+			return
+		}
+
+		// A listener that was healthy for a while starts over.
+		if time.Since(started) > watchMaxBackoff {
+			backoff = watchInitialBackoff
+			uncertain = 0
+		}
+		retry := watchRetryOf(err)
+		if retry == retryUncertain {
+			uncertain++
+			if uncertain > watchMaxUncertainRetries {
+				err = fmt.Errorf("giving up after %d reconnects: %w", watchMaxUncertainRetries, err)
+				retry = retryNever
+			}
+		}
+		if retry == retryNever {
+			b.logf(ctx, ERROR, "Watch on collection '%s' failed: %v", b.CollectionName, err)
+			sendEvent(ctx, ch, ChangeEvent{Err: err})
+			return
+		}
+		b.logf(ctx, WARN, "Watch on collection '%s' interrupted, reconnecting in %v: %v", b.CollectionName, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > watchMaxBackoff {
+			backoff = watchMaxBackoff
+		}
+	}
+}
+
+// documentChange returns the event for a new snapshot of a watched document,
+// given whether it was visible (present) before and is visible (alive) now.
+// A soft delete is a removal and a restore an addition.
+func documentChange(present, alive bool, lastUpdate, updated time.Time) (ChangeType, bool) {
+	switch {
+	case alive && !present:
+		return ChangeAdded, true
+	case alive && present && !updated.Equal(lastUpdate):
+		return ChangeModified, true
+	case !alive && present:
+		return ChangeRemoved, true
+	}
+	return "", false
+}
+
+// changeEvents converts the incremental changes of a query snapshot into events.
+func changeEvents(snap *firestore.QuerySnapshot, known map[string]time.Time, schema reflect.Type) ([]ChangeEvent, error) {
+	var events []ChangeEvent
+	for _, change := range snap.Changes {
+		ev := ChangeEvent{ID: change.Doc.Ref.ID, ReadTime: snap.ReadTime}
+		switch change.Kind {
+		case firestore.DocumentAdded:
+			ev.Type = ChangeAdded
+			known[ev.ID] = change.Doc.UpdateTime
+		case firestore.DocumentModified:
+			ev.Type = ChangeModified
+			known[ev.ID] = change.Doc.UpdateTime
+		case firestore.DocumentRemoved:
+			ev.Type = ChangeRemoved
+			delete(known, ev.ID)
+		}
+		if change.Doc.Exists() {
+			data, err := decodeSnapshot(change.Doc, schema)
+			if err != nil {
+				return nil, err
+			}
+			ev.Data = data
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// resyncEvents compares the full result set of the first snapshot after a
+// reconnect with the documents known before it, emitting only real changes.
+func resyncEvents(snap *firestore.QuerySnapshot, known map[string]time.Time, schema reflect.Type) ([]ChangeEvent, error) {
+	docs, err := snap.Documents.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]time.Time, len(docs))
+	byID := make(map[string]*firestore.DocumentSnapshot, len(docs))
+	for _, doc := range docs {
+		current[doc.Ref.ID] = doc.UpdateTime
+		byID[doc.Ref.ID] = doc
+	}
+
+	var events []ChangeEvent
+	for _, d := range diffKnown(known, current) {
+		ev := ChangeEvent{Type: d.kind, ID: d.id, ReadTime: snap.ReadTime}
+		if doc, ok := byID[d.id]; ok {
+			data, err := decodeSnapshot(doc, schema)
+			if err != nil {
+				return nil, err
+			}
+			ev.Data = data
+		}
+		events = append(events, ev)
+	}
+
+	for id := range known {
+		delete(known, id)
+	}
+	for id, updated := range current {
+		known[id] = updated
+	}
+	return events, nil
+}
+
+type knownDiff struct {
+	id   string
+	kind ChangeType
+}
+
+// diffKnown reports which documents were added, modified or removed between
+// two views of a result set, keyed by document ID and update time.
+func diffKnown(before, after map[string]time.Time) []knownDiff {
+	var diffs []knownDiff
+	for id, updated := range after {
+		prev, ok := before[id]
+		switch {
+		case !ok:
+			diffs = append(diffs, knownDiff{id: id, kind: ChangeAdded})
+		case !prev.Equal(updated):
+			diffs = append(diffs, knownDiff{id: id, kind: ChangeModified})
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			diffs = append(diffs, knownDiff{id: id, kind: ChangeRemoved})
+		}
+	}
+	return diffs
+}
+
+type watchRetry int
+
+const (
+	retryNever     watchRetry = iota // Permanent failure
+	retryAlways                      // Transient failure, retried with backoff
+	retryUncertain                   // Retried at most watchMaxUncertainRetries times in a row
+)
+
+// watchRetryOf reports whether a listener error is worth reconnecting for.
+// Errors without a gRPC status, such as documents that cannot be decoded into
+// the model, never go away on their own.
+func watchRetryOf(err error) watchRetry {
+	if err == nil || errors.Is(err, iterator.Done) {
+		// A listener that ends on its own is restarted as well.
+		return retryAlways
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return retryNever
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return retryAlways
+	case codes.Internal, codes.Unknown:
+		return retryUncertain
+	}
+	return retryNever
+}
+
+func isSoftDeleted(snap *firestore.DocumentSnapshot) bool {
+	deleted, ok := snap.Data()["deleted"].(bool)
+	return ok && deleted
+}
+
+func decodeSnapshot(snap *firestore.DocumentSnapshot, schema reflect.Type) (interface{}, error) {
+	item := reflect.New(schema).Interface()
+	if err := snap.DataTo(item); err != nil {
+		return nil, fmt.Errorf("failed to map document data: %v", err)
+	}
+	return item, nil
+}
+
+func sendEvent(ctx context.Context, ch chan<- ChangeEvent, ev ChangeEvent) bool {
+	select {
+	case ch <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}